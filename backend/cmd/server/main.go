@@ -26,19 +26,37 @@ func main() {
 	// 初始化仓储层
 	userRepo := repository.NewUserRepository(db)
 	marketRepo := repository.NewMarketRepository(db)
+	eventRepo := repository.NewEventRepository(db)
 	orderRepo := repository.NewOrderRepository(db)
 	positionRepo := repository.NewPositionRepository(db)
 	txRepo := repository.NewTransactionRepository(db)
+	tradeRepo := repository.NewTradeRepository(db)
+	configRepo := repository.NewConfigRepository(db)
 
 	// 初始化服务层
 	userService := service.NewUserService(userRepo, txRepo, cfg)
-	marketService := service.NewMarketService(marketRepo, positionRepo, userRepo, txRepo, db)
-	tradingService := service.NewTradingService(orderRepo, positionRepo, userRepo, marketRepo, txRepo, db)
+	configService := service.NewConfigService(configRepo)
+	tradingService := service.NewTradingService(orderRepo, positionRepo, userRepo, marketRepo, txRepo, tradeRepo, db, cfg)
+	marketService := service.NewMarketService(marketRepo, positionRepo, userRepo, txRepo, db, tradingService)
+	eventService := service.NewEventService(eventRepo, marketService)
+
+	// 写入默认系统配置
+	if err := configService.SeedDefaults(); err != nil {
+		log.Fatalf("Failed to seed system configs: %v", err)
+	}
+
+	// 启动过期订单清理
+	go tradingService.RunOrderExpirer(cfg.Trading.OrderExpiryInterval)
+
+	// 启动市场生命周期调度
+	go marketService.RunLifecycleScheduler(cfg.Market.LifecycleInterval)
 
 	// 初始化处理器
 	userHandler := api.NewUserHandler(userService)
 	marketHandler := api.NewMarketHandler(marketService)
+	eventHandler := api.NewEventHandler(eventService)
 	tradingHandler := api.NewTradingHandler(tradingService)
+	configHandler := api.NewConfigHandler(configService)
 
 	// 设置 Gin 模式
 	gin.SetMode(cfg.Server.Mode)
@@ -49,8 +67,8 @@ func main() {
 	// CORS 配置
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Idempotency-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
@@ -89,14 +107,35 @@ func main() {
 			markets.GET("/trending", marketHandler.GetTrendingMarkets)
 			markets.GET("/search", marketHandler.SearchMarkets)
 			markets.GET("/:id", marketHandler.GetMarket)
+			markets.GET("/:id/trades", tradingHandler.GetMarketTrades)
+			markets.POST("/:id/disputes", marketHandler.FileDispute)
+		}
+
+		// 赛事相关
+		events := authenticated.Group("/events")
+		{
+			events.GET("", eventHandler.ListEvents)
+			events.GET("/:id", eventHandler.GetEvent)
 		}
 
 		// 交易相关
 		trading := authenticated.Group("/trading")
 		{
 			trading.POST("/orders", tradingHandler.PlaceOrder)
+			trading.POST("/orders/batch", tradingHandler.PlaceBatchOrders)
 			trading.GET("/orders", tradingHandler.GetUserOrders)
+			trading.DELETE("/orders", tradingHandler.CancelAllOrders)
+			trading.PATCH("/orders/:id", tradingHandler.AmendOrder)
 			trading.DELETE("/orders/:id", tradingHandler.CancelOrder)
+			trading.GET("/orders/:id/history", tradingHandler.GetOrderHistory)
+			trading.GET("/orders/:id/fills", tradingHandler.GetOrderFills)
+			trading.GET("/quote", tradingHandler.GetQuote)
+			trading.POST("/conditional-orders", tradingHandler.CreateConditionalOrder)
+			trading.GET("/conditional-orders", tradingHandler.GetUserConditionalOrders)
+			trading.DELETE("/conditional-orders/:id", tradingHandler.CancelConditionalOrder)
+			trading.POST("/sets/mint", tradingHandler.MintCompleteSet)
+			trading.POST("/sets/redeem", tradingHandler.RedeemCompleteSet)
+			trading.POST("/conversions", tradingHandler.ConvertPositions)
 			trading.GET("/positions", tradingHandler.GetUserPositions)
 		}
 
@@ -108,6 +147,20 @@ func main() {
 			admin.POST("/markets", marketHandler.CreateMarket)
 			admin.PUT("/markets/:id", marketHandler.UpdateMarket)
 			admin.POST("/markets/:id/resolve", marketHandler.ResolveMarket)
+			admin.POST("/markets/:id/finalize", marketHandler.FinalizeResolution)
+			admin.POST("/markets/:id/unresolve", marketHandler.UnresolveMarket)
+			admin.GET("/markets/:id/resolutions", marketHandler.GetResolutions)
+			admin.POST("/markets/:id/halt", marketHandler.HaltMarket)
+			admin.POST("/markets/:id/resume", marketHandler.ResumeMarket)
+			admin.POST("/markets/:id/cancel", marketHandler.CancelMarket)
+			admin.GET("/markets/:id/status-history", marketHandler.GetStatusHistory)
+			admin.POST("/events", eventHandler.CreateEvent)
+			admin.PUT("/events/:id", eventHandler.UpdateEvent)
+			admin.POST("/events/:id/close", eventHandler.CloseEvent)
+			admin.POST("/events/:id/cancel", eventHandler.CancelEvent)
+			admin.GET("/fees/report", tradingHandler.GetFeeReport)
+			admin.GET("/configs", configHandler.ListConfigs)
+			admin.PUT("/configs/:key", configHandler.UpdateConfig)
 		}
 	}
 
@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,6 +14,8 @@ type Config struct {
 	Database DatabaseConfig
 	Redis    RedisConfig
 	JWT      JWTConfig
+	Trading  TradingConfig
+	Market   MarketConfig
 }
 
 type ServerConfig struct {
@@ -40,6 +44,16 @@ type JWTConfig struct {
 	ExpireHour int
 }
 
+type TradingConfig struct {
+	IdempotencyTTL      time.Duration // 下单幂等键有效期
+	OrderExpiryInterval time.Duration // 过期订单清理间隔
+	MaxBatchOrders      int           // 单次批量下单的最大订单数
+}
+
+type MarketConfig struct {
+	LifecycleInterval time.Duration // 市场生命周期调度间隔
+}
+
 func Load() *Config {
 	// 加载 .env 文件（如果存在）
 	_ = godotenv.Load()
@@ -67,6 +81,14 @@ func Load() *Config {
 			Secret:     getEnv("JWT_SECRET", "polygame-secret-key-change-in-production"),
 			ExpireHour: 24 * 7, // 7 days
 		},
+		Trading: TradingConfig{
+			IdempotencyTTL:      time.Duration(getEnvInt("IDEMPOTENCY_TTL_HOURS", 24)) * time.Hour,
+			OrderExpiryInterval: time.Duration(getEnvInt("ORDER_EXPIRY_INTERVAL_SECONDS", 30)) * time.Second,
+			MaxBatchOrders:      getEnvInt("MAX_BATCH_ORDERS", 50),
+		},
+		Market: MarketConfig{
+			LifecycleInterval: time.Duration(getEnvInt("MARKET_LIFECYCLE_INTERVAL_SECONDS", 30)) * time.Second,
+		},
 	}
 }
 
@@ -80,3 +102,18 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Environment variable %s must be an integer", key)
+	}
+	if n <= 0 {
+		log.Fatalf("Environment variable %s must be positive", key)
+	}
+	return n
+}
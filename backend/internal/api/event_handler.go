@@ -0,0 +1,238 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/huabtc/polygame/backend/internal/model"
+	"github.com/huabtc/polygame/backend/internal/service"
+)
+
+type EventHandler struct {
+	eventService *service.EventService
+}
+
+func NewEventHandler(eventService *service.EventService) *EventHandler {
+	return &EventHandler{eventService: eventService}
+}
+
+// eventRequest 创建与更新赛事的请求字段，更新时未提供的字段保持不变
+type eventRequest struct {
+	Title       *string `json:"title" binding:"omitempty,min=1,max=255"`
+	Description *string `json:"description"`
+	Category    *string `json:"category" binding:"omitempty,min=1,max=50"`
+	ImageURL    *string `json:"image_url" binding:"omitempty,max=500"`
+	StartTime   *string `json:"start_time"`
+	EndTime     *string `json:"end_time"`
+}
+
+// apply 将请求字段写入赛事
+func (req *eventRequest) apply(event *model.Event) error {
+	if req.Title != nil {
+		event.Title = *req.Title
+	}
+	if req.Description != nil {
+		event.Description = *req.Description
+	}
+	if req.Category != nil {
+		event.Category = *req.Category
+	}
+	if req.ImageURL != nil {
+		event.ImageURL = *req.ImageURL
+	}
+	if req.StartTime != nil {
+		t, err := time.Parse(time.RFC3339, *req.StartTime)
+		if err != nil {
+			return fmt.Errorf("invalid start_time: %w", err)
+		}
+		event.StartTime = &t
+	}
+	if req.EndTime != nil {
+		t, err := time.Parse(time.RFC3339, *req.EndTime)
+		if err != nil {
+			return fmt.Errorf("invalid end_time: %w", err)
+		}
+		event.EndTime = &t
+	}
+	if event.StartTime != nil && event.EndTime != nil && event.EndTime.Before(*event.StartTime) {
+		return errors.New("end_time must not be before start_time")
+	}
+	return nil
+}
+
+// CreateEvent 创建赛事（管理员）
+func (h *EventHandler) CreateEvent(c *gin.Context) {
+	var req struct {
+		eventRequest
+		MutuallyExclusive bool `json:"mutually_exclusive"` // 创建后不可修改
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Title == nil || req.Category == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title and category are required"})
+		return
+	}
+
+	event := &model.Event{
+		MutuallyExclusive: req.MutuallyExclusive,
+		CreatedBy:         c.GetUint("user_id"),
+	}
+	if err := req.apply(event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.eventService.CreateEvent(event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"event": event})
+}
+
+// GetEvent 获取赛事详情及其所有市场
+func (h *EventHandler) GetEvent(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, err := h.eventService.GetEvent(uri.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"event": event})
+}
+
+// ListEvents 获取赛事列表及其市场
+func (h *EventHandler) ListEvents(c *gin.Context) {
+	category := c.Query("category")
+	page := c.DefaultQuery("page", "1")
+	pageSize := c.DefaultQuery("page_size", "20")
+
+	var pageInt, pageSizeInt int
+	fmt.Sscanf(page, "%d", &pageInt)
+	fmt.Sscanf(pageSize, "%d", &pageSizeInt)
+
+	if pageInt < 1 {
+		pageInt = 1
+	}
+	if pageSizeInt < 1 || pageSizeInt > 100 {
+		pageSizeInt = 20
+	}
+
+	events, total, err := h.eventService.ListEvents(category, pageInt, pageSizeInt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"total":  total,
+		"page":   pageInt,
+	})
+}
+
+// UpdateEvent 更新赛事（管理员）
+func (h *EventHandler) UpdateEvent(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, err := h.eventService.GetEvent(uri.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req eventRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.eventService.UpdateEvent(event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"event": event})
+}
+
+// CloseEvent 关闭赛事下所有交易中的市场（管理员）
+func (h *EventHandler) CloseEvent(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+
+	closed, err := h.eventService.CloseEvent(uri.ID, adminID)
+	if err != nil {
+		marketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"closed_markets": closed})
+}
+
+// CancelEvent 取消赛事下所有市场并退款（管理员）
+func (h *EventHandler) CancelEvent(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req struct {
+		RefundBasis string `json:"refund_basis" binding:"omitempty,oneof=cost_basis last_price"`
+	}
+
+	// 请求体可省略，表示按持仓成本价退款
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+
+	refunds, err := h.eventService.CancelEvent(uri.ID, adminID, req.RefundBasis)
+	if err != nil {
+		marketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refunds": refunds})
+}
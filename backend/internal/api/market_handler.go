@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -21,13 +23,28 @@ func NewMarketHandler(marketService *service.MarketService) *MarketHandler {
 // CreateMarket 创建市场（管理员）
 func (h *MarketHandler) CreateMarket(c *gin.Context) {
 	var req struct {
-		Title       string   `json:"title" binding:"required"`
-		Description string   `json:"description"`
-		Category    string   `json:"category" binding:"required"`
-		ImageURL    string   `json:"image_url"`
-		StartTime   *string  `json:"start_time"`
-		EndTime     *string  `json:"end_time"`
-		Outcomes    []string `json:"outcomes" binding:"required,min=2"`
+		EventID        *uint    `json:"event_id"`
+		Title          string   `json:"title" binding:"required"`
+		Description    string   `json:"description"`
+		Category       string   `json:"category" binding:"required"`
+		MarketType     string   `json:"market_type" binding:"omitempty,oneof=binary categorical scalar"`
+		ScalarLower    *float64 `json:"scalar_lower"`
+		ScalarUpper    *float64 `json:"scalar_upper"`
+		ImageURL       string   `json:"image_url"`
+		StartTime      *string  `json:"start_time"`
+		EndTime        *string  `json:"end_time"`
+		ResolutionTime *string  `json:"resolution_time"`
+		Outcomes       []string `json:"outcomes" binding:"omitempty,min=2"` // 区间市场不需要，固定为 LONG/SHORT
+		LiquidityParam float64  `json:"liquidity_param" binding:"omitempty,gt=0"`
+
+		MaxOrderShares    float64 `json:"max_order_shares" binding:"omitempty,gte=0"`
+		MaxPositionShares float64 `json:"max_position_shares" binding:"omitempty,gte=0"`
+		MaxMarketNotional float64 `json:"max_market_notional" binding:"omitempty,gte=0"`
+
+		BreakerPriceMove       float64 `json:"breaker_price_move" binding:"omitempty,gte=0,lt=1"`
+		BreakerWindowMinutes   int     `json:"breaker_window_minutes" binding:"omitempty,gte=0"`
+		BreakerCooldownMinutes int     `json:"breaker_cooldown_minutes" binding:"omitempty,gte=0"`
+		BreakerScope           string  `json:"breaker_scope" binding:"omitempty,oneof=outcome market"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -38,31 +55,71 @@ func (h *MarketHandler) CreateMarket(c *gin.Context) {
 	createdBy := c.GetUint("user_id")
 
 	market := &model.Market{
-		Title:       req.Title,
-		Description: req.Description,
-		Category:    req.Category,
-		ImageURL:    req.ImageURL,
-		Status:      "active",
-		CreatedBy:   createdBy,
+		EventID:        req.EventID,
+		Title:          req.Title,
+		Description:    req.Description,
+		Category:       req.Category,
+		MarketType:     req.MarketType,
+		ScalarLower:    req.ScalarLower,
+		ScalarUpper:    req.ScalarUpper,
+		ImageURL:       req.ImageURL,
+		Status:         "active",
+		LiquidityParam: req.LiquidityParam,
+		CreatedBy:      createdBy,
+
+		MaxOrderShares:    req.MaxOrderShares,
+		MaxPositionShares: req.MaxPositionShares,
+		MaxMarketNotional: req.MaxMarketNotional,
+
+		BreakerPriceMove:       req.BreakerPriceMove,
+		BreakerWindowMinutes:   req.BreakerWindowMinutes,
+		BreakerCooldownMinutes: req.BreakerCooldownMinutes,
+		BreakerScope:           req.BreakerScope,
+	}
+
+	// 时间无法解析时拒绝创建，避免零值时间被生命周期调度立即关闭市场或误报结算逾期
+	var err error
+	if market.StartTime, err = parseRequestTime("start_time", req.StartTime); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	if req.StartTime != nil {
-		t, _ := time.Parse(time.RFC3339, *req.StartTime)
-		market.StartTime = &t
+	if market.EndTime, err = parseRequestTime("end_time", req.EndTime); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if market.ResolutionTime, err = parseRequestTime("resolution_time", req.ResolutionTime); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if market.StartTime != nil && market.EndTime != nil && market.EndTime.Before(*market.StartTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must not be before start_time"})
+		return
 	}
-	if req.EndTime != nil {
-		t, _ := time.Parse(time.RFC3339, *req.EndTime)
-		market.EndTime = &t
+	// 开始时间未到的市场先待开放，由生命周期调度在开始时间开放交易
+	if market.StartTime != nil && market.StartTime.After(time.Now()) {
+		market.Status = "pending"
 	}
 
 	if err := h.marketService.CreateMarket(market, req.Outcomes); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		marketError(c, err, http.StatusBadRequest)
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"market": market})
 }
 
+// parseRequestTime 解析请求中可选的 RFC 3339 时间字段，未提供时返回 nil
+func parseRequestTime(name string, value *string) (*time.Time, error) {
+	if value == nil {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return &t, nil
+}
+
 // GetMarket 获取市场详情
 func (h *MarketHandler) GetMarket(c *gin.Context) {
 	var uri struct {
@@ -74,7 +131,7 @@ func (h *MarketHandler) GetMarket(c *gin.Context) {
 		return
 	}
 
-	market, err := h.marketService.GetMarket(uri.ID)
+	market, err := h.marketService.GetMarketDetail(uri.ID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -132,10 +189,20 @@ func (h *MarketHandler) UpdateMarket(c *gin.Context) {
 	}
 
 	var req struct {
+		EventID     *uint   `json:"event_id"` // 0 表示移出赛事
 		Title       *string `json:"title"`
 		Description *string `json:"description"`
 		Status      *string `json:"status"`
 		ImageURL    *string `json:"image_url"`
+
+		MaxOrderShares    *float64 `json:"max_order_shares" binding:"omitempty,gte=0"`
+		MaxPositionShares *float64 `json:"max_position_shares" binding:"omitempty,gte=0"`
+		MaxMarketNotional *float64 `json:"max_market_notional" binding:"omitempty,gte=0"`
+
+		BreakerPriceMove       *float64 `json:"breaker_price_move" binding:"omitempty,gte=0,lt=1"`
+		BreakerWindowMinutes   *int     `json:"breaker_window_minutes" binding:"omitempty,gte=0"`
+		BreakerCooldownMinutes *int     `json:"breaker_cooldown_minutes" binding:"omitempty,gte=0"`
+		BreakerScope           *string  `json:"breaker_scope" binding:"omitempty,oneof=outcome market"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -143,6 +210,12 @@ func (h *MarketHandler) UpdateMarket(c *gin.Context) {
 		return
 	}
 
+	if req.EventID != nil {
+		market.EventID = req.EventID
+		if *req.EventID == 0 {
+			market.EventID = nil
+		}
+	}
 	if req.Title != nil {
 		market.Title = *req.Title
 	}
@@ -155,9 +228,30 @@ func (h *MarketHandler) UpdateMarket(c *gin.Context) {
 	if req.ImageURL != nil {
 		market.ImageURL = *req.ImageURL
 	}
+	if req.MaxOrderShares != nil {
+		market.MaxOrderShares = *req.MaxOrderShares
+	}
+	if req.MaxPositionShares != nil {
+		market.MaxPositionShares = *req.MaxPositionShares
+	}
+	if req.MaxMarketNotional != nil {
+		market.MaxMarketNotional = *req.MaxMarketNotional
+	}
+	if req.BreakerPriceMove != nil {
+		market.BreakerPriceMove = *req.BreakerPriceMove
+	}
+	if req.BreakerWindowMinutes != nil {
+		market.BreakerWindowMinutes = *req.BreakerWindowMinutes
+	}
+	if req.BreakerCooldownMinutes != nil {
+		market.BreakerCooldownMinutes = *req.BreakerCooldownMinutes
+	}
+	if req.BreakerScope != nil {
+		market.BreakerScope = *req.BreakerScope
+	}
 
-	if err := h.marketService.UpdateMarket(market); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.marketService.UpdateMarket(market, c.GetUint("user_id")); err != nil {
+		marketError(c, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -176,7 +270,9 @@ func (h *MarketHandler) ResolveMarket(c *gin.Context) {
 	}
 
 	var req struct {
-		WinningOutcomeID uint `json:"winning_outcome_id" binding:"required"`
+		WinningOutcomeID *uint              `json:"winning_outcome_id"`
+		Payouts          []resolutionPayout `json:"payouts" binding:"omitempty,dive"`
+		Value            *float64           `json:"value"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -184,14 +280,140 @@ func (h *MarketHandler) ResolveMarket(c *gin.Context) {
 		return
 	}
 
+	input, err := resolutionInput(req.WinningOutcomeID, req.Payouts, req.Value)
+	if err == nil && input == nil {
+		err = errors.New("winning_outcome_id, payouts or value is required")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	resolvedBy := c.GetUint("user_id")
 
-	if err := h.marketService.ResolveMarket(uri.ID, req.WinningOutcomeID, resolvedBy); err != nil {
+	resolution, err := h.marketService.ResolveMarket(uri.ID, *input, resolvedBy)
+	if err != nil {
+		marketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"resolution": resolution})
+}
+
+// FinalizeResolution 确认结算提议并立即结算（管理员）
+func (h *MarketHandler) FinalizeResolution(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+
+	resolution, err := h.marketService.FinalizeResolution(uri.ID, adminID)
+	if err != nil {
+		marketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"resolution": resolution})
+}
+
+// UnresolveMarket 撤回结算提议或撤销结算，可同时以新结果重新提议（管理员）
+func (h *MarketHandler) UnresolveMarket(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Market resolved successfully"})
+	var req struct {
+		Reason           string             `json:"reason" binding:"required,max=255"`
+		WinningOutcomeID *uint              `json:"winning_outcome_id"`
+		Payouts          []resolutionPayout `json:"payouts" binding:"omitempty,dive"`
+		Value            *float64           `json:"value"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input, err := resolutionInput(req.WinningOutcomeID, req.Payouts, req.Value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+
+	reversed, resolution, err := h.marketService.UnresolveMarket(uri.ID, adminID, req.Reason, input)
+	if err != nil {
+		marketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reversed":   reversed,
+		"resolution": resolution,
+	})
+}
+
+// GetResolutions 获取市场的结算提议及争议（管理员）
+func (h *MarketHandler) GetResolutions(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resolutions, err := h.marketService.GetResolutions(uri.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"resolutions": resolutions})
+}
+
+// FileDispute 对市场的结算提议提出争议
+func (h *MarketHandler) FileDispute(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required,max=2000"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+
+	dispute, err := h.marketService.FileDispute(uri.ID, userID, req.Reason)
+	if err != nil {
+		marketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"dispute": dispute})
 }
 
 // GetTrendingMarkets 获取热门市场
@@ -247,3 +469,168 @@ func (h *MarketHandler) SearchMarkets(c *gin.Context) {
 		"page":    pageInt,
 	})
 }
+
+// HaltMarket 暂停市场或单个结果选项（管理员）
+func (h *MarketHandler) HaltMarket(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req struct {
+		OutcomeID       *uint `json:"outcome_id"`
+		DurationMinutes int   `json:"duration_minutes" binding:"omitempty,gte=0"`
+	}
+
+	// 请求体可省略，表示暂停整个市场直到管理员恢复
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+	duration := time.Duration(req.DurationMinutes) * time.Minute
+
+	if err := h.marketService.HaltMarket(uri.ID, req.OutcomeID, duration, adminID); err != nil {
+		marketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Trading halted successfully"})
+}
+
+// ResumeMarket 恢复市场交易（管理员）
+func (h *MarketHandler) ResumeMarket(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+
+	if err := h.marketService.ResumeMarket(uri.ID, adminID); err != nil {
+		marketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Trading resumed successfully"})
+}
+
+// CancelMarket 取消市场并退款（管理员）
+func (h *MarketHandler) CancelMarket(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req struct {
+		RefundBasis string `json:"refund_basis" binding:"omitempty,oneof=cost_basis last_price"`
+	}
+
+	// 请求体可省略，表示按持仓成本价退款
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+
+	refund, err := h.marketService.CancelMarket(uri.ID, adminID, req.RefundBasis)
+	if err != nil {
+		marketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refund": refund})
+}
+
+// GetStatusHistory 获取市场状态变更记录（管理员）
+func (h *MarketHandler) GetStatusHistory(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, err := h.marketService.GetStatusHistory(uri.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+// marketError 市场状态错误返回 400（无效状态）或 409（非法或并发的状态变更、结算状态冲突），其他错误返回 status
+func marketError(c *gin.Context, err error, status int) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMarketStatus), errors.Is(err, service.ErrGroupMember):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrEventNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidStatusTransition), errors.Is(err, service.ErrMarketStatusChanged),
+		errors.Is(err, service.ErrNoResolution), errors.Is(err, service.ErrDisputeWindowClosed),
+		errors.Is(err, service.ErrDisputeExists), errors.Is(err, service.ErrGroupResolvedYes),
+		errors.Is(err, service.ErrGroupNeedsYes), errors.Is(err, service.ErrGroupTraded),
+		errors.Is(err, service.ErrGroupLeave):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// resolutionPayout 结算请求中单个结果选项每份额的支付比例
+type resolutionPayout struct {
+	OutcomeID uint    `json:"outcome_id" binding:"required"`
+	Payout    float64 `json:"payout" binding:"min=0,max=1"`
+}
+
+// resolutionInput 将结算请求转换为结算输入：winning_outcome_id（该结果选项支付 1.0）、payouts
+// 与区间市场的 value 三选一，都未提供时返回 nil
+func resolutionInput(winningOutcomeID *uint, payouts []resolutionPayout, value *float64) (*service.ResolutionInput, error) {
+	provided := 0
+	if winningOutcomeID != nil {
+		provided++
+	}
+	if len(payouts) > 0 {
+		provided++
+	}
+	if value != nil {
+		provided++
+	}
+	if provided > 1 {
+		return nil, errors.New("provide only one of winning_outcome_id, payouts or value")
+	}
+
+	switch {
+	case winningOutcomeID != nil:
+		return &service.ResolutionInput{Payouts: map[uint]float64{*winningOutcomeID: 1}}, nil
+	case value != nil:
+		return &service.ResolutionInput{Value: value}, nil
+	case len(payouts) == 0:
+		return nil, nil
+	}
+
+	vector := make(map[uint]float64, len(payouts))
+	for _, payout := range payouts {
+		if _, ok := vector[payout.OutcomeID]; ok {
+			return nil, fmt.Errorf("duplicate payout for outcome %d", payout.OutcomeID)
+		}
+		vector[payout.OutcomeID] = payout.Payout
+	}
+	return &service.ResolutionInput{Payouts: vector}, nil
+}
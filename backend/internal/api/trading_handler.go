@@ -1,8 +1,10 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/huabtc/polygame/backend/internal/service"
@@ -16,37 +18,168 @@ func NewTradingHandler(tradingService *service.TradingService) *TradingHandler {
 	return &TradingHandler{tradingService: tradingService}
 }
 
+// placeOrderRequest 下单请求
+type placeOrderRequest struct {
+	MarketID    uint       `json:"market_id" binding:"required"`
+	OutcomeID   uint       `json:"outcome_id" binding:"required"`
+	OrderType   string     `json:"order_type" binding:"required,oneof=buy sell"`
+	OrderKind   string     `json:"order_kind" binding:"omitempty,oneof=limit market"`
+	Shares      float64    `json:"shares" binding:"omitempty,gt=0"`
+	Price       float64    `json:"price" binding:"omitempty,gt=0,lte=1"`
+	Budget      float64    `json:"budget" binding:"omitempty,gt=0"`
+	MaxCost     float64    `json:"max_cost" binding:"omitempty,gt=0"`
+	MinProceeds float64    `json:"min_proceeds" binding:"omitempty,gt=0"`
+	TimeInForce string     `json:"time_in_force" binding:"omitempty,oneof=GTC GTD IOC FOK"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+
+	SelfTradePrevention string `json:"self_trade_prevention" binding:"omitempty,oneof=cancel_newest cancel_oldest cancel_both decrement"`
+}
+
+func (r *placeOrderRequest) params() service.PlaceOrderParams {
+	return service.PlaceOrderParams{
+		MarketID:    r.MarketID,
+		OutcomeID:   r.OutcomeID,
+		OrderType:   r.OrderType,
+		OrderKind:   r.OrderKind,
+		Shares:      r.Shares,
+		Price:       r.Price,
+		Budget:      r.Budget,
+		MaxCost:     r.MaxCost,
+		MinProceeds: r.MinProceeds,
+		TimeInForce: r.TimeInForce,
+		ExpiresAt:   r.ExpiresAt,
+
+		SelfTradePrevention: r.SelfTradePrevention,
+	}
+}
+
 // PlaceOrder 下单
 func (h *TradingHandler) PlaceOrder(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
+	var req placeOrderRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	if len(idempotencyKey) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 100 characters"})
+		return
+	}
+
+	params := req.params()
+	params.IdempotencyKey = idempotencyKey
+
+	order, err := h.tradingService.PlaceOrder(userID, params)
+	if errors.Is(err, service.ErrIdempotencyKeyReused) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		tradeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"order": order})
+}
+
+// PlaceBatchOrders 批量下单
+func (h *TradingHandler) PlaceBatchOrders(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
 	var req struct {
-		MarketID   uint    `json:"market_id" binding:"required"`
-		OutcomeID  uint    `json:"outcome_id" binding:"required"`
-		OrderType  string  `json:"order_type" binding:"required,oneof=buy sell"`
-		Shares     float64 `json:"shares" binding:"required,gt=0"`
-		Price      float64 `json:"price" binding:"required,gt=0,lte=1"`
+		Mode   string              `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+		Orders []placeOrderRequest `json:"orders" binding:"required,min=1,dive"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Mode == "" {
+		req.Mode = service.BatchModeAtomic
+	}
+
+	orders := make([]service.PlaceOrderParams, len(req.Orders))
+	for i := range req.Orders {
+		orders[i] = req.Orders[i].params()
+	}
+
+	results, err := h.tradingService.PlaceBatchOrders(userID, req.Mode, orders)
+	if err != nil {
+		// 原子模式失败时返回导致失败的订单序号
+		resp := gin.H{"error": err.Error()}
+		var batchErr *service.BatchOrderError
+		if errors.As(err, &batchErr) {
+			resp["index"] = batchErr.Index
+		}
+		var limitErr *service.LimitError
+		if errors.As(err, &limitErr) {
+			resp["code"] = limitErr.Code
+		}
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"mode": req.Mode, "results": results})
+}
+
+// CancelAllOrders 撤销用户在市场内的所有挂单
+func (h *TradingHandler) CancelAllOrders(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var query struct {
+		MarketID uint `form:"market_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	order, err := h.tradingService.PlaceOrder(
-		userID,
-		req.MarketID,
-		req.OutcomeID,
-		req.OrderType,
-		req.Shares,
-		req.Price,
-	)
+	cancelled, err := h.tradingService.CancelAllOrders(userID, query.MarketID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"order": order})
+	c.JSON(http.StatusOK, gin.H{"message": "Orders cancelled successfully", "cancelled": cancelled})
+}
+
+// tradeError 返回交易错误，持仓限制错误附带错误码
+func tradeError(c *gin.Context, err error) {
+	var limitErr *service.LimitError
+	if errors.As(err, &limitErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": limitErr.Code})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// GetQuote 获取下单前报价
+func (h *TradingHandler) GetQuote(c *gin.Context) {
+	var query struct {
+		MarketID  uint    `form:"market_id" binding:"required"`
+		OutcomeID uint    `form:"outcome_id" binding:"required"`
+		Side      string  `form:"side" binding:"required,oneof=buy sell"`
+		Shares    float64 `form:"shares" binding:"required,gt=0"`
+	}
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quote, err := h.tradingService.GetQuote(query.MarketID, query.OutcomeID, query.Side, query.Shares)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"quote": quote})
 }
 
 // GetUserOrders 获取用户订单列表
@@ -80,6 +213,327 @@ func (h *TradingHandler) GetUserOrders(c *gin.Context) {
 	})
 }
 
+// AmendOrder 修改挂单价格或份额
+func (h *TradingHandler) AmendOrder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req struct {
+		Price  *float64 `json:"price" binding:"omitempty,gt=0,lte=1"`
+		Shares *float64 `json:"shares" binding:"omitempty,gt=0"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.tradingService.AmendOrder(uri.ID, userID, service.AmendOrderParams{
+		Price:  req.Price,
+		Shares: req.Shares,
+	})
+	if err != nil {
+		tradeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"order": order})
+}
+
+// GetOrderHistory 获取订单变更记录
+func (h *TradingHandler) GetOrderHistory(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, err := h.tradingService.GetOrderHistory(uri.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+// GetOrderFills 获取订单成交明细
+func (h *TradingHandler) GetOrderFills(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, trades, err := h.tradingService.GetOrderFills(uri.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order": order,
+		"fills": trades,
+	})
+}
+
+// GetMarketTrades 获取市场成交记录（游标分页）
+func (h *TradingHandler) GetMarketTrades(c *gin.Context) {
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var cursor uint
+	var limit int
+	fmt.Sscanf(c.DefaultQuery("cursor", "0"), "%d", &cursor)
+	fmt.Sscanf(c.DefaultQuery("limit", "50"), "%d", &limit)
+
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	trades, next, err := h.tradingService.GetMarketTrades(uri.ID, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{"trades": trades, "next_cursor": nil}
+	if next > 0 {
+		resp["next_cursor"] = next
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetFeeReport 获取手续费报表（管理员）
+func (h *TradingHandler) GetFeeReport(c *gin.Context) {
+	var query struct {
+		From     string `form:"from"`
+		To       string `form:"to"`
+		MarketID uint   `form:"market_id"`
+	}
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 默认最近 30 天，to 为包含当天的日期
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if query.To != "" {
+		t, err := time.Parse("2006-01-02", query.To)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date in YYYY-MM-DD format"})
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -29)
+	if query.From != "" {
+		t, err := time.Parse("2006-01-02", query.From)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date in YYYY-MM-DD format"})
+			return
+		}
+		from = t
+	}
+
+	report, err := h.tradingService.GetFeeReport(from, to.AddDate(0, 0, 1), query.MarketID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// CreateConditionalOrder 创建止损 / 止盈条件单
+func (h *TradingHandler) CreateConditionalOrder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req struct {
+		MarketID         uint    `json:"market_id" binding:"required"`
+		OutcomeID        uint    `json:"outcome_id" binding:"required"`
+		OrderType        string  `json:"order_type" binding:"required,oneof=buy sell"`
+		OrderKind        string  `json:"order_kind" binding:"omitempty,oneof=limit market"`
+		Shares           float64 `json:"shares" binding:"required,gt=0"`
+		Price            float64 `json:"price" binding:"omitempty,gt=0,lte=1"`
+		TriggerPrice     float64 `json:"trigger_price" binding:"required,gt=0,lt=1"`
+		TriggerDirection string  `json:"trigger_direction" binding:"required,oneof=below above"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.tradingService.CreateConditionalOrder(userID, service.ConditionalOrderParams{
+		MarketID:         req.MarketID,
+		OutcomeID:        req.OutcomeID,
+		OrderType:        req.OrderType,
+		OrderKind:        req.OrderKind,
+		Shares:           req.Shares,
+		Price:            req.Price,
+		TriggerPrice:     req.TriggerPrice,
+		TriggerDirection: req.TriggerDirection,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"conditional_order": order})
+}
+
+// GetUserConditionalOrders 获取用户条件单列表
+func (h *TradingHandler) GetUserConditionalOrders(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	page := c.DefaultQuery("page", "1")
+	pageSize := c.DefaultQuery("page_size", "20")
+
+	var pageInt, pageSizeInt int
+	fmt.Sscanf(page, "%d", &pageInt)
+	fmt.Sscanf(pageSize, "%d", &pageSizeInt)
+
+	if pageInt < 1 {
+		pageInt = 1
+	}
+	if pageSizeInt < 1 || pageSizeInt > 100 {
+		pageSizeInt = 20
+	}
+
+	orders, total, err := h.tradingService.GetUserConditionalOrders(userID, pageInt, pageSizeInt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conditional_orders": orders,
+		"total":              total,
+		"page":               pageInt,
+	})
+}
+
+// CancelConditionalOrder 取消条件单
+func (h *TradingHandler) CancelConditionalOrder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var uri struct {
+		ID uint `uri:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.tradingService.CancelConditionalOrder(uri.ID, userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Conditional order cancelled successfully"})
+}
+
+// MintCompleteSet 铸造完整份额组
+func (h *TradingHandler) MintCompleteSet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req struct {
+		MarketID uint    `json:"market_id" binding:"required"`
+		Sets     float64 `json:"sets" binding:"required,gt=0"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := h.tradingService.MintCompleteSet(userID, req.MarketID, req.Sets)
+	if err != nil {
+		tradeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Complete sets minted successfully", "balance": balance})
+}
+
+// ConvertPositions 互斥组内的负风险转换：NO 份额与组内其他市场的 YES 份额互相转换
+func (h *TradingHandler) ConvertPositions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req struct {
+		MarketID  uint    `json:"market_id" binding:"required"`
+		Shares    float64 `json:"shares" binding:"required,gt=0"`
+		Direction string  `json:"direction" binding:"required,oneof=no_to_yes yes_to_no"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conversion, err := h.tradingService.ConvertPositions(userID, req.MarketID, req.Shares, req.Direction)
+	if err != nil {
+		if errors.Is(err, service.ErrGroupResolvedYes) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		tradeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conversion": conversion})
+}
+
+// RedeemCompleteSet 赎回完整份额组
+func (h *TradingHandler) RedeemCompleteSet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req struct {
+		MarketID uint    `json:"market_id" binding:"required"`
+		Sets     float64 `json:"sets" binding:"required,gt=0"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := h.tradingService.RedeemCompleteSet(userID, req.MarketID, req.Sets)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Complete sets redeemed successfully", "balance": balance})
+}
+
 // GetUserPositions 获取用户持仓
 func (h *TradingHandler) GetUserPositions(c *gin.Context) {
 	userID := c.GetUint("user_id")
@@ -8,37 +8,72 @@ import (
 
 // User 用户模型
 type User struct {
-	ID             uint           `gorm:"primarykey" json:"id"`
-	Username       string         `gorm:"uniqueIndex;size:50;not null" json:"username"`
-	Email          string         `gorm:"uniqueIndex;size:100;not null" json:"email"`
-	PasswordHash   string         `gorm:"size:255;not null" json:"-"`
-	VirtualBalance float64        `gorm:"type:decimal(20,2);default:10000" json:"virtual_balance"` // 初始虚拟积分 10000
-	Avatar         string         `gorm:"size:255" json:"avatar"`
-	IsAdmin        bool           `gorm:"default:false" json:"is_admin"`
-	CreatedAt      time.Time      `json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint           `gorm:"primarykey" json:"id"`
+	Username        string         `gorm:"uniqueIndex;size:50;not null" json:"username"`
+	Email           string         `gorm:"uniqueIndex;size:100;not null" json:"email"`
+	PasswordHash    string         `gorm:"size:255;not null" json:"-"`
+	VirtualBalance  float64        `gorm:"type:decimal(20,2);default:10000" json:"virtual_balance"` // 初始虚拟积分 10000
+	ReservedBalance float64        `gorm:"type:decimal(20,2);default:0" json:"reserved_balance"`    // 挂单冻结的积分
+	Avatar          string         `gorm:"size:255" json:"avatar"`
+	IsAdmin         bool           `gorm:"default:false" json:"is_admin"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Event 赛事模型：一场比赛等事件下的多个市场
+type Event struct {
+	ID                uint           `gorm:"primarykey" json:"id"`
+	Title             string         `gorm:"size:255;not null" json:"title"`
+	Description       string         `gorm:"type:text" json:"description"`
+	Category          string         `gorm:"size:50;not null;index" json:"category"` // sports, esports, entertainment, tech
+	ImageURL          string         `gorm:"size:500" json:"image_url"`
+	StartTime         *time.Time     `json:"start_time"`
+	EndTime           *time.Time     `json:"end_time"`
+	MutuallyExclusive bool           `gorm:"not null;default:false" json:"mutually_exclusive"` // 互斥组：市场均为 YES/NO 二元市场，且恰好一个结算为 YES
+	CreatedBy         uint           `gorm:"not null" json:"created_by"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+	Markets           []Market       `gorm:"foreignKey:EventID" json:"markets,omitempty"`
 }
 
 // Market 市场模型
 type Market struct {
-	ID             uint           `gorm:"primarykey" json:"id"`
-	Title          string         `gorm:"size:255;not null" json:"title"`
-	Description    string         `gorm:"type:text" json:"description"`
-	Category       string         `gorm:"size:50;not null;index" json:"category"` // sports, esports, entertainment, tech
-	ImageURL       string         `gorm:"size:500" json:"image_url"`
-	StartTime      *time.Time     `json:"start_time"`
-	EndTime        *time.Time     `json:"end_time"`
-	ResolutionTime *time.Time     `json:"resolution_time"`
-	Status         string         `gorm:"size:20;not null;default:'pending';index" json:"status"` // pending, active, closed, resolved, cancelled
-	TotalVolume    float64        `gorm:"type:decimal(20,2);default:0" json:"total_volume"`
-	CreatedBy      uint           `gorm:"not null" json:"created_by"`
-	ResolvedBy     *uint          `json:"resolved_by"`
-	WinningOutcome *uint          `json:"winning_outcome"`
-	CreatedAt      time.Time      `json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
-	Outcomes       []Outcome      `gorm:"foreignKey:MarketID" json:"outcomes,omitempty"`
+	ID                     uint               `gorm:"primarykey" json:"id"`
+	EventID                *uint              `gorm:"index" json:"event_id"` // 所属赛事，为空表示独立市场
+	Title                  string             `gorm:"size:255;not null" json:"title"`
+	Description            string             `gorm:"type:text" json:"description"`
+	Category               string             `gorm:"size:50;not null;index" json:"category"`                    // sports, esports, entertainment, tech
+	MarketType             string             `gorm:"size:20;not null;default:'categorical'" json:"market_type"` // binary, categorical, scalar
+	ScalarLower            *float64           `gorm:"type:decimal(20,4)" json:"scalar_lower,omitempty"`          // 区间市场下界，结算值不高于下界时 SHORT 全额获胜
+	ScalarUpper            *float64           `gorm:"type:decimal(20,4)" json:"scalar_upper,omitempty"`          // 区间市场上界，结算值不低于上界时 LONG 全额获胜
+	ImageURL               string             `gorm:"size:500" json:"image_url"`
+	StartTime              *time.Time         `json:"start_time"`
+	EndTime                *time.Time         `json:"end_time"`
+	ResolutionTime         *time.Time         `json:"resolution_time"`
+	ResolutionOverdueAt    *time.Time         `json:"resolution_overdue_at"`                                  // 超过结算时间仍未结算而发出告警的时间
+	Status                 string             `gorm:"size:20;not null;default:'pending';index" json:"status"` // pending, active, halted, closed, proposed, resolved, cancelled
+	HaltedUntil            *time.Time         `json:"halted_until"`                                           // 熔断暂停的冷却结束时间，为空表示需管理员恢复
+	TotalVolume            float64            `gorm:"type:decimal(20,2);default:0" json:"total_volume"`
+	LiquidityParam         float64            `gorm:"type:decimal(20,4);default:100" json:"liquidity_param"`   // LMSR 流动性参数 b
+	MaxOrderShares         float64            `gorm:"type:decimal(20,4);default:0" json:"max_order_shares"`    // 单笔订单最大份额，0 表示使用全局默认值
+	MaxPositionShares      float64            `gorm:"type:decimal(20,4);default:0" json:"max_position_shares"` // 每个用户每个结果选项最大持仓份额，0 表示使用全局默认值
+	MaxMarketNotional      float64            `gorm:"type:decimal(20,2);default:0" json:"max_market_notional"` // 每个用户在本市场的最大持仓成本，0 表示使用全局默认值
+	BreakerPriceMove       float64            `gorm:"type:decimal(10,4);default:0" json:"breaker_price_move"`  // 熔断阈值：窗口内价格变动幅度，0 表示使用全局默认值
+	BreakerWindowMinutes   int                `gorm:"default:0" json:"breaker_window_minutes"`                 // 熔断检测窗口（分钟），0 表示使用全局默认值
+	BreakerCooldownMinutes int                `gorm:"default:0" json:"breaker_cooldown_minutes"`               // 熔断后自动恢复的冷却时间（分钟），0 表示使用全局默认值
+	BreakerScope           string             `gorm:"size:10" json:"breaker_scope"`                            // outcome（仅暂停该结果选项）, market（暂停整个市场），空表示使用全局默认值
+	CreatedBy              uint               `gorm:"not null" json:"created_by"`
+	ResolvedBy             *uint              `json:"resolved_by"`
+	WinningOutcome         *uint              `json:"winning_outcome"`                                    // 支付比例为 1 的获胜结果，按比例拆分结算时为空（见 Outcome.Payout）
+	ResolvedValue          *float64           `gorm:"type:decimal(20,4)" json:"resolved_value,omitempty"` // 区间市场的结算数值
+	CreatedAt              time.Time          `json:"created_at"`
+	UpdatedAt              time.Time          `json:"updated_at"`
+	DeletedAt              gorm.DeletedAt     `gorm:"index" json:"-"`
+	Outcomes               []Outcome          `gorm:"foreignKey:MarketID" json:"outcomes,omitempty"`
+	Halts                  []MarketHalt       `gorm:"foreignKey:MarketID" json:"halts,omitempty"`
+	Resolutions            []MarketResolution `gorm:"foreignKey:MarketID" json:"resolutions,omitempty"`
 }
 
 // Outcome 市场结果选项模型
@@ -48,56 +83,220 @@ type Outcome struct {
 	OutcomeName  string         `gorm:"size:100;not null" json:"outcome_name"`
 	CurrentPrice float64        `gorm:"type:decimal(10,4);default:0.5" json:"current_price"` // 0-1 之间
 	TotalShares  float64        `gorm:"type:decimal(20,2);default:0" json:"total_shares"`
+	AMMShares    float64        `gorm:"type:decimal(20,4);default:0" json:"amm_shares"` // LMSR 做市商已发行份额 q
 	TotalVolume  float64        `gorm:"type:decimal(20,2);default:0" json:"total_volume"`
+	Status       string         `gorm:"size:20;not null;default:'active'" json:"status"` // active, halted
+	HaltedUntil  *time.Time     `json:"halted_until"`
+	Payout       *float64       `gorm:"type:decimal(10,6)" json:"payout"` // 结算时每份额支付的比例（0-1），未结算为空
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// PriceHistory 结果选项价格记录，每次价格变动写入一条
+type PriceHistory struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	MarketID  uint      `gorm:"not null;index" json:"market_id"`
+	OutcomeID uint      `gorm:"not null;index:idx_outcome_price_time,priority:1" json:"outcome_id"`
+	Price     float64   `gorm:"type:decimal(10,4);not null" json:"price"`
+	CreatedAt time.Time `gorm:"index:idx_outcome_price_time,priority:2" json:"created_at"`
+}
+
+// MarketHalt 市场或结果选项的暂停与恢复记录
+type MarketHalt struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	MarketID       uint       `gorm:"not null;index" json:"market_id"`
+	OutcomeID      *uint      `json:"outcome_id"`                     // 为空表示暂停整个市场
+	Reason         string     `gorm:"size:50;not null" json:"reason"` // circuit_breaker, admin
+	ReferencePrice float64    `gorm:"type:decimal(10,4)" json:"reference_price"`
+	Price          float64    `gorm:"type:decimal(10,4)" json:"price"`
+	HaltedBy       *uint      `json:"halted_by"`
+	HaltedAt       time.Time  `gorm:"not null" json:"halted_at"`
+	HaltedUntil    *time.Time `json:"halted_until"`
+	ResumedAt      *time.Time `json:"resumed_at"`
+	ResumedBy      *uint      `json:"resumed_by"`
+	ResumeReason   string     `gorm:"size:50" json:"resume_reason,omitempty"` // cooldown, admin
+}
+
+// MarketStatusHistory 市场状态变更记录
+type MarketStatusHistory struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	MarketID   uint      `gorm:"not null;index" json:"market_id"`
+	FromStatus string    `gorm:"size:20;not null" json:"from_status"`
+	ToStatus   string    `gorm:"size:20;not null" json:"to_status"`
+	ChangedBy  *uint     `json:"changed_by"`            // 为空表示系统自动变更
+	Reason     string    `gorm:"size:50" json:"reason"` // admin_update, start_time, end_time, circuit_breaker, admin_halt, admin_resume, cooldown, resolution_proposed, resolution_finalized, resolution_withdrawn, resolution_reversed, admin_cancel, event_close, event_cancel, group_resolved
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// MarketResolution 市场结算提议。提议后进入争议期，争议期结束（或管理员确认）后结算，结算可由管理员撤销
+type MarketResolution struct {
+	ID                 uint                `gorm:"primarykey" json:"id"`
+	MarketID           uint                `gorm:"not null;index" json:"market_id"`
+	OutcomeID          *uint               `json:"outcome_id"`                                              // 提议的获胜结果，按比例拆分结算时为空
+	Value              *float64            `gorm:"type:decimal(20,4)" json:"value,omitempty"`               // 区间市场提议的结算数值
+	ParentResolutionID *uint               `gorm:"index" json:"parent_resolution_id,omitempty"`             // 互斥组内因其他市场结算为 YES 而自动结算为 NO 时，对应的结算提议
+	Status             string              `gorm:"size:20;not null;default:'proposed';index" json:"status"` // proposed, finalized, withdrawn, reversed
+	ProposedBy         uint                `gorm:"not null" json:"proposed_by"`
+	DisputeDeadline    time.Time           `gorm:"not null" json:"dispute_deadline"`
+	FinalizedBy        *uint               `json:"finalized_by"` // 为空表示争议期结束后自动结算
+	FinalizedAt        *time.Time          `json:"finalized_at"`
+	ReversedBy         *uint               `json:"reversed_by"` // 撤回提议或撤销结算的管理员
+	ReversedAt         *time.Time          `json:"reversed_at"`
+	ReverseReason      string              `gorm:"size:255" json:"reverse_reason,omitempty"`
+	CreatedAt          time.Time           `json:"created_at"`
+	Payouts            []ResolutionPayout  `gorm:"foreignKey:ResolutionID" json:"payouts,omitempty"`
+	Disputes           []ResolutionDispute `gorm:"foreignKey:ResolutionID" json:"disputes,omitempty"`
+}
+
+// ResolutionPayout 结算提议的支付向量：每个结果选项每份额支付的比例，合计为 1，未列出的结果选项支付 0
+type ResolutionPayout struct {
+	ID           uint    `gorm:"primarykey" json:"id"`
+	ResolutionID uint    `gorm:"not null;uniqueIndex:idx_payout_resolution_outcome,priority:1" json:"resolution_id"`
+	OutcomeID    uint    `gorm:"not null;uniqueIndex:idx_payout_resolution_outcome,priority:2" json:"outcome_id"`
+	Payout       float64 `gorm:"type:decimal(10,6);not null" json:"payout"`
+}
+
+// ResolutionDispute 用户在争议期内对结算提议提出的争议
+type ResolutionDispute struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	ResolutionID uint       `gorm:"not null;uniqueIndex:idx_dispute_resolution_user,priority:1" json:"resolution_id"`
+	MarketID     uint       `gorm:"not null;index" json:"market_id"`
+	UserID       uint       `gorm:"not null;uniqueIndex:idx_dispute_resolution_user,priority:2" json:"user_id"`
+	Reason       string     `gorm:"type:text;not null" json:"reason"`
+	Status       string     `gorm:"size:20;not null;default:'open'" json:"status"` // open, upheld（提议被撤回）, rejected（提议被结算）
+	ReviewedBy   *uint      `json:"reviewed_by"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
 // Order 订单模型
 type Order struct {
-	ID         uint           `gorm:"primarykey" json:"id"`
-	UserID     uint           `gorm:"not null;index" json:"user_id"`
-	MarketID   uint           `gorm:"not null;index" json:"market_id"`
-	OutcomeID  uint           `gorm:"not null;index" json:"outcome_id"`
-	OrderType  string         `gorm:"size:10;not null" json:"order_type"` // buy, sell
-	Shares     float64        `gorm:"type:decimal(20,4);not null" json:"shares"`
-	Price      float64        `gorm:"type:decimal(10,4);not null" json:"price"`
-	TotalCost  float64        `gorm:"type:decimal(20,2);not null" json:"total_cost"`
-	Status     string         `gorm:"size:20;not null;default:'pending';index" json:"status"` // pending, filled, partially_filled, cancelled
-	FilledAt   *time.Time     `json:"filled_at"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
-	User       User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Market     Market         `gorm:"foreignKey:MarketID" json:"market,omitempty"`
-	Outcome    Outcome        `gorm:"foreignKey:OutcomeID" json:"outcome,omitempty"`
+	ID                  uint           `gorm:"primarykey" json:"id"`
+	UserID              uint           `gorm:"not null;index" json:"user_id"`
+	MarketID            uint           `gorm:"not null;index" json:"market_id"`
+	OutcomeID           uint           `gorm:"not null;index" json:"outcome_id"`
+	OrderType           string         `gorm:"size:10;not null" json:"order_type"`                 // buy, sell
+	OrderKind           string         `gorm:"size:10;not null;default:'limit'" json:"order_kind"` // limit, market
+	Shares              float64        `gorm:"type:decimal(20,4);not null" json:"shares"`
+	FilledShares        float64        `gorm:"type:decimal(20,4);default:0" json:"filled_shares"`
+	Price               float64        `gorm:"type:decimal(10,4);not null" json:"price"`
+	TotalCost           float64        `gorm:"type:decimal(20,2);not null" json:"total_cost"`        // 已成交金额
+	AvgFillPrice        float64        `gorm:"type:decimal(10,4);default:0" json:"avg_fill_price"`   // 成交均价（VWAP）
+	Budget              float64        `gorm:"type:decimal(20,2);default:0" json:"budget,omitempty"` // 市价买单的最大花费
+	MakerFeeRate        float64        `gorm:"type:decimal(10,6);default:0" json:"maker_fee_rate"`   // 下单时锁定的挂单费率
+	TakerFeeRate        float64        `gorm:"type:decimal(10,6);default:0" json:"taker_fee_rate"`   // 下单时锁定的吃单费率
+	FeesPaid            float64        `gorm:"type:decimal(20,4);default:0" json:"fees_paid"`
+	ReservedAmount      float64        `gorm:"type:decimal(20,2);default:0" json:"reserved_amount"`                   // 买单当前冻结的积分（含挂单手续费）
+	SelfTradePrevention string         `gorm:"size:20;not null;default:'cancel_newest'" json:"self_trade_prevention"` // cancel_newest, cancel_oldest, cancel_both, decrement
+	PreventedShares     float64        `gorm:"type:decimal(20,4);default:0" json:"prevented_shares"`                  // 因自成交保护被撤销或扣减的份额
+	Status              string         `gorm:"size:20;not null;default:'pending';index" json:"status"`                // pending, filled, partially_filled, cancelled
+	StatusReason        string         `gorm:"size:50" json:"status_reason,omitempty"`                                // 撤单原因，如 user_cancelled, expired, market_closed, self_trade_prevented
+	TimeInForce         string         `gorm:"size:3;not null;default:'GTC'" json:"time_in_force"`                    // GTC, GTD, IOC, FOK
+	ExpiresAt           *time.Time     `gorm:"index" json:"expires_at"`                                               // GTD 订单的过期时间
+	FilledAt            *time.Time     `json:"filled_at"`
+	PriorityAt          *time.Time     `json:"priority_at"` // 改单失去时间优先后的排队时间，为空时按 created_at 排队
+	IdempotencyKey      string         `gorm:"size:100" json:"idempotency_key,omitempty"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
+	User                User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Market              Market         `gorm:"foreignKey:MarketID" json:"market,omitempty"`
+	Outcome             Outcome        `gorm:"foreignKey:OutcomeID" json:"outcome,omitempty"`
+}
+
+// Trade 成交记录，每次订单簿撮合或做市商成交生成一条
+type Trade struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	MarketID     uint      `gorm:"not null;index" json:"market_id"`
+	OutcomeID    uint      `gorm:"not null;index" json:"outcome_id"`
+	TakerOrderID uint      `gorm:"not null;index" json:"taker_order_id"`
+	MakerOrderID *uint     `gorm:"index" json:"maker_order_id"` // 与做市商成交时为空
+	TakerUserID  uint      `gorm:"not null" json:"-"`
+	MakerUserID  *uint     `json:"-"`
+	TakerSide    string    `gorm:"size:10;not null" json:"taker_side"` // buy, sell
+	Price        float64   `gorm:"type:decimal(10,4);not null" json:"price"`
+	Shares       float64   `gorm:"type:decimal(20,4);not null" json:"shares"`
+	Notional     float64   `gorm:"type:decimal(20,2);not null" json:"notional"`
+	TakerFee     float64   `gorm:"type:decimal(20,4);default:0" json:"taker_fee"`
+	MakerFee     float64   `gorm:"type:decimal(20,4);default:0" json:"maker_fee"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OrderHistory 订单变更记录
+type OrderHistory struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	OrderID      uint      `gorm:"not null;index" json:"order_id"`
+	Action       string    `gorm:"size:20;not null" json:"action"` // amended
+	OldPrice     float64   `gorm:"type:decimal(10,4)" json:"old_price"`
+	NewPrice     float64   `gorm:"type:decimal(10,4)" json:"new_price"`
+	OldShares    float64   `gorm:"type:decimal(20,4)" json:"old_shares"`
+	NewShares    float64   `gorm:"type:decimal(20,4)" json:"new_shares"`
+	PriorityKept bool      `json:"priority_kept"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ConditionalOrder 条件单（止损 / 止盈），价格触发后转为实际订单
+type ConditionalOrder struct {
+	ID               uint           `gorm:"primarykey" json:"id"`
+	UserID           uint           `gorm:"not null;index" json:"user_id"`
+	MarketID         uint           `gorm:"not null;index" json:"market_id"`
+	OutcomeID        uint           `gorm:"not null;index" json:"outcome_id"`
+	OrderType        string         `gorm:"size:10;not null" json:"order_type"`                  // buy, sell
+	OrderKind        string         `gorm:"size:10;not null;default:'market'" json:"order_kind"` // 触发后下单类型：limit, market
+	Shares           float64        `gorm:"type:decimal(20,4);not null" json:"shares"`
+	Price            float64        `gorm:"type:decimal(10,4);default:0" json:"price"` // 触发后的限价或最差价格
+	TriggerPrice     float64        `gorm:"type:decimal(10,4);not null" json:"trigger_price"`
+	TriggerDirection string         `gorm:"size:10;not null" json:"trigger_direction"`             // below（价格 <= 触发价）, above（价格 >= 触发价）
+	Status           string         `gorm:"size:20;not null;default:'active';index" json:"status"` // active, triggered, cancelled, failed
+	StatusReason     string         `gorm:"size:255" json:"status_reason,omitempty"`
+	TriggeredOrderID *uint          `json:"triggered_order_id"`
+	TriggeredAt      *time.Time     `json:"triggered_at"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+	Market           Market         `gorm:"foreignKey:MarketID" json:"market,omitempty"`
+	Outcome          Outcome        `gorm:"foreignKey:OutcomeID" json:"outcome,omitempty"`
+}
+
+// IdempotencyKey 下单幂等键（按用户隔离）
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_user_idempotency_key,priority:1" json:"user_id"`
+	Key         string    `gorm:"size:100;not null;uniqueIndex:idx_user_idempotency_key,priority:2" json:"key"`
+	RequestHash string    `gorm:"size:64;not null" json:"request_hash"`
+	OrderID     uint      `gorm:"not null" json:"order_id"`
+	Response    string    `gorm:"type:text" json:"-"` // 首次请求返回的订单（JSON），重复请求原样返回
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // Position 持仓模型
 type Position struct {
-	ID        uint           `gorm:"primarykey" json:"id"`
-	UserID    uint           `gorm:"not null;index:idx_user_market_outcome,priority:1" json:"user_id"`
-	MarketID  uint           `gorm:"not null;index:idx_user_market_outcome,priority:2" json:"market_id"`
-	OutcomeID uint           `gorm:"not null;index:idx_user_market_outcome,priority:3" json:"outcome_id"`
-	Shares    float64        `gorm:"type:decimal(20,4);not null" json:"shares"`
-	AvgPrice  float64        `gorm:"type:decimal(10,4);not null" json:"avg_price"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	Market    Market         `gorm:"foreignKey:MarketID" json:"market,omitempty"`
-	Outcome   Outcome        `gorm:"foreignKey:OutcomeID" json:"outcome,omitempty"`
+	ID           uint           `gorm:"primarykey" json:"id"`
+	UserID       uint           `gorm:"not null;index:idx_user_market_outcome,priority:1" json:"user_id"`
+	MarketID     uint           `gorm:"not null;index:idx_user_market_outcome,priority:2" json:"market_id"`
+	OutcomeID    uint           `gorm:"not null;index:idx_user_market_outcome,priority:3" json:"outcome_id"`
+	Shares       float64        `gorm:"type:decimal(20,4);not null" json:"shares"`
+	LockedShares float64        `gorm:"type:decimal(20,4);default:0" json:"locked_shares"` // 卖出挂单冻结的份额
+	AvgPrice     float64        `gorm:"type:decimal(10,4);not null" json:"avg_price"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	Market       Market         `gorm:"foreignKey:MarketID" json:"market,omitempty"`
+	Outcome      Outcome        `gorm:"foreignKey:OutcomeID" json:"outcome,omitempty"`
 }
 
 // Transaction 交易记录模型
 type Transaction struct {
 	ID           uint      `gorm:"primarykey" json:"id"`
 	UserID       uint      `gorm:"not null;index" json:"user_id"`
-	Type         string    `gorm:"size:20;not null" json:"type"` // register_bonus, trade_buy, trade_sell, settlement_win, settlement_loss
+	Type         string    `gorm:"size:20;not null" json:"type"` // register_bonus, trade_buy, trade_sell, order_reserve, order_release, trade_fee, set_mint, set_redeem, settlement_win, settlement_loss, settlement_reversal, market_refund, neg_risk_convert
 	Amount       float64   `gorm:"type:decimal(20,2);not null" json:"amount"`
 	BalanceAfter float64   `gorm:"type:decimal(20,2);not null" json:"balance_after"`
 	OrderID      *uint     `json:"order_id"`
 	MarketID     *uint     `json:"market_id"`
+	ResolutionID *uint     `gorm:"index" json:"resolution_id,omitempty"` // 结算及撤销结算交易对应的结算提议
 	Description  string    `gorm:"size:255" json:"description"`
 	CreatedAt    time.Time `json:"created_at"`
 }
@@ -115,6 +314,14 @@ type MarketStatistics struct {
 	UpdatedAt       time.Time `json:"updated_at"`
 }
 
+// TreasuryAccount 平台金库账户，如手续费收入
+type TreasuryAccount struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Name      string    `gorm:"uniqueIndex;size:50;not null" json:"name"`
+	Balance   float64   `gorm:"type:decimal(20,4);default:0" json:"balance"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // SystemConfig 系统配置模型
 type SystemConfig struct {
 	ID        uint      `gorm:"primarykey" json:"id"`
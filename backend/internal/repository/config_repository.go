@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ConfigRepository struct {
+	db *gorm.DB
+}
+
+func NewConfigRepository(db *gorm.DB) *ConfigRepository {
+	return &ConfigRepository{db: db}
+}
+
+// List 获取系统配置列表
+func (r *ConfigRepository) List(category string) ([]model.SystemConfig, error) {
+	var configs []model.SystemConfig
+	query := r.db.Model(&model.SystemConfig{})
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	err := query.Order("category ASC, key ASC").Find(&configs).Error
+	return configs, err
+}
+
+// FindByKey 根据键查找配置
+func (r *ConfigRepository) FindByKey(key string) (*model.SystemConfig, error) {
+	var config model.SystemConfig
+	err := r.db.Where("key = ?", key).First(&config).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("config not found")
+		}
+		return nil, err
+	}
+	return &config, nil
+}
+
+// CreateIfNotExists 写入配置，已存在的键保持不变
+func (r *ConfigRepository) CreateIfNotExists(configs []model.SystemConfig) error {
+	if len(configs) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoNothing: true,
+	}).Create(&configs).Error
+}
+
+// UpdateValue 更新配置值
+func (r *ConfigRepository) UpdateValue(key, value string) error {
+	return r.db.Model(&model.SystemConfig{}).
+		Where("key = ?", key).
+		Update("value", value).Error
+}
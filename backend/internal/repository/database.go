@@ -36,23 +36,35 @@ func InitDatabase(cfg *config.Config) error {
 	log.Println("Database connected successfully")
 
 	// 自动迁移数据库表
-	if err := autoMigrate(); err != nil {
+	if err := AutoMigrate(DB); err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	return nil
 }
 
-// autoMigrate 自动迁移数据库表
-func autoMigrate() error {
-	return DB.AutoMigrate(
+// AutoMigrate 自动迁移数据库表
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(
 		&model.User{},
+		&model.Event{},
 		&model.Market{},
 		&model.Outcome{},
+		&model.PriceHistory{},
+		&model.MarketHalt{},
+		&model.MarketStatusHistory{},
+		&model.MarketResolution{},
+		&model.ResolutionPayout{},
+		&model.ResolutionDispute{},
 		&model.Order{},
+		&model.Trade{},
+		&model.OrderHistory{},
+		&model.IdempotencyKey{},
+		&model.ConditionalOrder{},
 		&model.Position{},
 		&model.Transaction{},
 		&model.MarketStatistics{},
+		&model.TreasuryAccount{},
 		&model.SystemConfig{},
 	)
 }
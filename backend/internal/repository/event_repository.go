@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type EventRepository struct {
+	db *gorm.DB
+}
+
+func NewEventRepository(db *gorm.DB) *EventRepository {
+	return &EventRepository{db: db}
+}
+
+// Create 创建赛事
+func (r *EventRepository) Create(event *model.Event) error {
+	return r.db.Create(event).Error
+}
+
+// FindByID 根据 ID 查找赛事，包含其市场及结果选项
+func (r *EventRepository) FindByID(id uint) (*model.Event, error) {
+	var event model.Event
+	err := r.db.Preload("Markets", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).
+		Preload("Markets.Outcomes").
+		First(&event, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("event not found")
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+// List 获取赛事列表，包含其市场及结果选项
+func (r *EventRepository) List(category string, page, pageSize int) ([]model.Event, int64, error) {
+	var events []model.Event
+	var total int64
+
+	offset := (page - 1) * pageSize
+	query := r.db.Model(&model.Event{})
+
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Preload("Markets", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).
+		Preload("Markets.Outcomes").
+		Offset(offset).
+		Limit(pageSize).
+		Order("start_time DESC NULLS LAST, id DESC").
+		Find(&events).Error
+
+	return events, total, err
+}
+
+// Update 更新赛事
+func (r *EventRepository) Update(event *model.Event) error {
+	return r.db.Omit("Markets").Save(event).Error
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"errors"
+	"time"
 
 	"github.com/huabtc/polygame/backend/internal/model"
 	"gorm.io/gorm"
@@ -116,3 +117,97 @@ func (r *MarketRepository) Search(keyword string, page, pageSize int) ([]model.M
 
 	return markets, total, err
 }
+
+// FindDetailByID 查找市场详情，包含结果选项、最近的暂停记录和结算提议
+func (r *MarketRepository) FindDetailByID(id uint) (*model.Market, error) {
+	var market model.Market
+	err := r.db.Preload("Outcomes").
+		Preload("Halts", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id DESC").Limit(20)
+		}).
+		Preload("Resolutions", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id DESC").Limit(5)
+		}).
+		Preload("Resolutions.Payouts").
+		First(&market, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("market not found")
+		}
+		return nil, err
+	}
+	return &market, nil
+}
+
+// FindStatusHistory 获取市场的状态变更记录（按时间先后）
+func (r *MarketRepository) FindStatusHistory(marketID uint) ([]model.MarketStatusHistory, error) {
+	var history []model.MarketStatusHistory
+	err := r.db.Where("market_id = ?", marketID).
+		Order("id ASC").
+		Find(&history).Error
+	return history, err
+}
+
+// FindResolutions 获取市场的结算提议及其争议（按时间先后）
+func (r *MarketRepository) FindResolutions(marketID uint) ([]model.MarketResolution, error) {
+	var resolutions []model.MarketResolution
+	err := r.db.Preload("Payouts").
+		Preload("Disputes", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		Where("market_id = ?", marketID).
+		Order("id ASC").
+		Find(&resolutions).Error
+	return resolutions, err
+}
+
+// FindResolutionsDueToFinalize 查找争议期已结束且没有未处理争议的结算提议所属市场
+func (r *MarketRepository) FindResolutionsDueToFinalize(now time.Time) ([]uint, error) {
+	var marketIDs []uint
+	err := r.db.Model(&model.MarketResolution{}).
+		Where("status = ? AND dispute_deadline <= ?", "proposed", now).
+		Where("NOT EXISTS (?)", r.db.Model(&model.ResolutionDispute{}).
+			Select("1").
+			Where("resolution_id = market_resolutions.id AND status = ?", "open")).
+		Pluck("market_id", &marketIDs).Error
+	return marketIDs, err
+}
+
+// FindMarketsDueToOpen 查找已到开始时间的待开放市场
+func (r *MarketRepository) FindMarketsDueToOpen(now time.Time) ([]uint, error) {
+	var marketIDs []uint
+	err := r.db.Model(&model.Market{}).
+		Where("status = ? AND start_time <= ?", "pending", now).
+		Pluck("id", &marketIDs).Error
+	return marketIDs, err
+}
+
+// FindMarketsDueToClose 查找已到结束时间仍在交易中的市场
+func (r *MarketRepository) FindMarketsDueToClose(now time.Time) ([]uint, error) {
+	var marketIDs []uint
+	err := r.db.Model(&model.Market{}).
+		Where("status IN ? AND end_time <= ?", []string{"active", "halted"}, now).
+		Pluck("id", &marketIDs).Error
+	return marketIDs, err
+}
+
+// FindMarketsOverdueForResolution 查找已过结算时间仍未结算且尚未告警的已关闭市场
+func (r *MarketRepository) FindMarketsOverdueForResolution(now time.Time) ([]model.Market, error) {
+	var markets []model.Market
+	err := r.db.Select("id", "title", "resolution_time").
+		Where("status = ? AND resolution_time <= ? AND resolution_overdue_at IS NULL", "closed", now).
+		Find(&markets).Error
+	return markets, err
+}
+
+// FindMarketsWithExpiredHalts 查找市场或结果选项的暂停冷却期已结束的市场
+func (r *MarketRepository) FindMarketsWithExpiredHalts(now time.Time) ([]uint, error) {
+	var marketIDs []uint
+	err := r.db.Model(&model.Market{}).
+		Where("status = ? AND halted_until <= ?", "halted", now).
+		Or("id IN (?)", r.db.Model(&model.Outcome{}).
+			Select("market_id").
+			Where("status = ? AND halted_until <= ?", "halted", now)).
+		Pluck("id", &marketIDs).Error
+	return marketIDs, err
+}
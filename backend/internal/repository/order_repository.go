@@ -2,6 +2,7 @@ package repository
 
 import (
 	"errors"
+	"time"
 
 	"github.com/huabtc/polygame/backend/internal/model"
 	"gorm.io/gorm"
@@ -66,9 +67,92 @@ func (r *OrderRepository) UpdateStatus(orderID uint, status string) error {
 		Update("status", status).Error
 }
 
-// Cancel 取消订单
-func (r *OrderRepository) Cancel(orderID uint, userID uint) error {
-	return r.db.Model(&model.Order{}).
-		Where("id = ? AND user_id = ? AND status = ?", orderID, userID, "pending").
-		Update("status", "cancelled").Error
+// FindIdempotencyKey 查找用户未过期的幂等键
+func (r *OrderRepository) FindIdempotencyKey(userID uint, key string) (*model.IdempotencyKey, error) {
+	var record model.IdempotencyKey
+	err := r.db.Where("user_id = ? AND key = ? AND expires_at > ?", userID, key, time.Now()).
+		First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// FindMarketsWithExpiredOrders 查找存在已过期 GTD 挂单的市场
+func (r *OrderRepository) FindMarketsWithExpiredOrders(now time.Time) ([]uint, error) {
+	var marketIDs []uint
+	err := r.db.Model(&model.Order{}).
+		Where("status IN ? AND time_in_force = ? AND expires_at <= ?", []string{"pending", "partially_filled"}, "GTD", now).
+		Distinct().
+		Pluck("market_id", &marketIDs).Error
+	return marketIDs, err
+}
+
+// FindInactiveMarketsWithOpenOrders 查找已不在交易中（非 active / halted）但仍有挂单的市场
+func (r *OrderRepository) FindInactiveMarketsWithOpenOrders() ([]uint, error) {
+	var marketIDs []uint
+	err := r.db.Model(&model.Order{}).
+		Joins("JOIN markets ON markets.id = orders.market_id").
+		Where("orders.status IN ? AND markets.status NOT IN ?", []string{"pending", "partially_filled"}, []string{"active", "halted"}).
+		Distinct().
+		Pluck("orders.market_id", &marketIDs).Error
+	return marketIDs, err
+}
+
+// CreateConditional 创建条件单
+func (r *OrderRepository) CreateConditional(order *model.ConditionalOrder) error {
+	return r.db.Create(order).Error
+}
+
+// FindConditionalByUserID 根据用户 ID 查找条件单列表
+func (r *OrderRepository) FindConditionalByUserID(userID uint, page, pageSize int) ([]model.ConditionalOrder, int64, error) {
+	var orders []model.ConditionalOrder
+	var total int64
+
+	offset := (page - 1) * pageSize
+
+	if err := r.db.Model(&model.ConditionalOrder{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := r.db.Preload("Market").Preload("Outcome").
+		Where("user_id = ?", userID).
+		Offset(offset).
+		Limit(pageSize).
+		Order("created_at DESC").
+		Find(&orders).Error
+
+	return orders, total, err
+}
+
+// FindActiveConditionalByMarket 查找市场内所有生效中的条件单
+func (r *OrderRepository) FindActiveConditionalByMarket(marketID uint) ([]model.ConditionalOrder, error) {
+	var orders []model.ConditionalOrder
+	err := r.db.Where("market_id = ? AND status = ?", marketID, "active").
+		Order("id ASC").
+		Find(&orders).Error
+	return orders, err
+}
+
+// UpdateConditionalStatus 条件单状态迁移，仅当当前状态为 from 时生效
+func (r *OrderRepository) UpdateConditionalStatus(id uint, from string, updates map[string]interface{}) (bool, error) {
+	result := r.db.Model(&model.ConditionalOrder{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateHistory 创建订单变更记录
+func (r *OrderRepository) CreateHistory(history *model.OrderHistory) error {
+	return r.db.Create(history).Error
+}
+
+// FindHistoryByOrderID 获取订单变更记录
+func (r *OrderRepository) FindHistoryByOrderID(orderID uint) ([]model.OrderHistory, error) {
+	var history []model.OrderHistory
+	err := r.db.Where("order_id = ?", orderID).Order("id ASC").Find(&history).Error
+	return history, err
 }
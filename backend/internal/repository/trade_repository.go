@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type TradeRepository struct {
+	db *gorm.DB
+}
+
+func NewTradeRepository(db *gorm.DB) *TradeRepository {
+	return &TradeRepository{db: db}
+}
+
+// FindByMarketID 按游标分页获取市场成交记录（按 ID 倒序，cursor 为 0 时从最新开始）
+func (r *TradeRepository) FindByMarketID(marketID, cursor uint, limit int) ([]model.Trade, error) {
+	var trades []model.Trade
+	query := r.db.Where("market_id = ?", marketID)
+	if cursor > 0 {
+		query = query.Where("id < ?", cursor)
+	}
+	err := query.Order("id DESC").Limit(limit).Find(&trades).Error
+	return trades, err
+}
+
+// FindByOrderID 获取订单（作为 maker 或 taker）的所有成交记录
+func (r *TradeRepository) FindByOrderID(orderID uint) ([]model.Trade, error) {
+	var trades []model.Trade
+	err := r.db.Where("taker_order_id = ? OR maker_order_id = ?", orderID, orderID).
+		Order("id ASC").
+		Find(&trades).Error
+	return trades, err
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/huabtc/polygame/backend/internal/model"
 	"gorm.io/gorm"
 )
@@ -37,3 +39,28 @@ func (r *TransactionRepository) FindByUserID(userID uint, page, pageSize int) ([
 
 	return transactions, total, err
 }
+
+// FeeReportRow 单个市场单日的手续费汇总
+type FeeReportRow struct {
+	MarketID  uint    `json:"market_id"`
+	Day       string  `json:"day"`
+	TotalFees float64 `json:"total_fees"`
+	FeeCount  int64   `json:"fee_count"`
+}
+
+// FeeReport 按市场和日期汇总 [from, to) 内的手续费，marketID 为 0 表示所有市场
+func (r *TransactionRepository) FeeReport(from, to time.Time, marketID uint) ([]FeeReportRow, error) {
+	var rows []FeeReportRow
+
+	query := r.db.Model(&model.Transaction{}).
+		Select("market_id, TO_CHAR(DATE(created_at), 'YYYY-MM-DD') AS day, -SUM(amount) AS total_fees, COUNT(*) AS fee_count").
+		Where("type = ? AND created_at >= ? AND created_at < ?", "trade_fee", from, to)
+	if marketID > 0 {
+		query = query.Where("market_id = ?", marketID)
+	}
+
+	err := query.Group("market_id, DATE(created_at)").
+		Order("day DESC, market_id ASC").
+		Scan(&rows).Error
+	return rows, err
+}
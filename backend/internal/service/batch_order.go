@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// 批量下单模式
+const (
+	BatchModeAtomic     = "atomic"      // 全部成功或全部不生效
+	BatchModeBestEffort = "best_effort" // 逐笔独立下单，失败的订单不影响其他订单
+)
+
+// BatchOrderResult 批量下单中单笔订单的结果
+type BatchOrderResult struct {
+	Index int          `json:"index"`
+	Order *model.Order `json:"order,omitempty"`
+	Error string       `json:"error,omitempty"`
+	Code  string       `json:"code,omitempty"`
+}
+
+// BatchOrderError 原子批量下单失败，Index 为导致失败的订单序号
+type BatchOrderError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchOrderError) Error() string {
+	return fmt.Sprintf("order %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchOrderError) Unwrap() error {
+	return e.Err
+}
+
+// PlaceBatchOrders 批量下单。atomic 模式下所有订单在同一事务内执行，任一失败则全部回滚；
+// best_effort 模式下逐笔下单并返回每笔的结果。
+func (s *TradingService) PlaceBatchOrders(userID uint, mode string, orders []PlaceOrderParams) ([]BatchOrderResult, error) {
+	if len(orders) == 0 {
+		return nil, errors.New("no orders")
+	}
+	if len(orders) > s.cfg.Trading.MaxBatchOrders {
+		return nil, fmt.Errorf("at most %d orders per batch", s.cfg.Trading.MaxBatchOrders)
+	}
+
+	results := make([]BatchOrderResult, len(orders))
+	switch mode {
+	case BatchModeBestEffort:
+		for i, params := range orders {
+			order, err := s.PlaceOrder(userID, params)
+			results[i] = BatchOrderResult{Index: i, Order: order}
+			if err != nil {
+				results[i].Error = err.Error()
+				var limitErr *LimitError
+				if errors.As(err, &limitErr) {
+					results[i].Code = limitErr.Code
+				}
+			}
+		}
+	case BatchModeAtomic:
+		placed, err := s.placeAtomicBatch(userID, orders)
+		if err != nil {
+			return nil, err
+		}
+		for i, order := range placed {
+			results[i] = BatchOrderResult{Index: i, Order: order}
+		}
+	default:
+		return nil, errors.New("invalid batch mode")
+	}
+	return results, nil
+}
+
+// placeAtomicBatch 在单个事务内按顺序执行所有订单，失败时返回 *BatchOrderError。
+// 撮合读取的是事务内的挂单，后面的订单能看到前面挂出的订单，与之交叉时按自成交保护处理。
+func (s *TradingService) placeAtomicBatch(userID uint, orders []PlaceOrderParams) ([]*model.Order, error) {
+	markets := make(map[uint]*model.Market)
+	for i := range orders {
+		params := &orders[i]
+		if err := params.normalize(); err != nil {
+			return nil, &BatchOrderError{Index: i, Err: err}
+		}
+
+		market, ok := markets[params.MarketID]
+		if !ok {
+			var err error
+			if market, err = s.marketRepo.FindByID(params.MarketID); err != nil {
+				return nil, &BatchOrderError{Index: i, Err: err}
+			}
+			markets[params.MarketID] = market
+		}
+		if err := marketTradingError(market.Status); err != nil {
+			return nil, &BatchOrderError{Index: i, Err: err}
+		}
+		if !hasOutcome(market, params.OutcomeID) {
+			return nil, &BatchOrderError{Index: i, Err: errors.New("invalid outcome")}
+		}
+	}
+
+	// 按市场 ID 升序加锁，与其他批量请求保持一致的加锁顺序
+	marketIDs := make([]uint, 0, len(markets))
+	for id := range markets {
+		marketIDs = append(marketIDs, id)
+	}
+	sort.Slice(marketIDs, func(i, j int) bool { return marketIDs[i] < marketIDs[j] })
+	for _, id := range marketIDs {
+		unlock := s.engine.lockMarket(id)
+		defer unlock()
+	}
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	makers := make(map[uint]*marketMaker, len(marketIDs))
+	for _, id := range marketIDs {
+		mm, err := loadMarketMaker(tx, markets[id])
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		makers[id] = mm
+	}
+
+	placed := make([]*model.Order, len(orders))
+	for i, params := range orders {
+		order, err := s.executeOrder(tx, userID, markets[params.MarketID], makers[params.MarketID], params)
+		if err != nil {
+			tx.Rollback()
+			return nil, &BatchOrderError{Index: i, Err: err}
+		}
+		placed[i] = order
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	traded := make(map[uint]bool)
+	for _, order := range placed {
+		if order.FilledShares > 0 {
+			traded[order.MarketID] = true
+		}
+	}
+	for marketID := range traded {
+		go s.evaluateConditionalOrders(marketID)
+	}
+	return placed, nil
+}
+
+// CancelAllOrders 撤销用户在市场内的所有挂单并释放冻结，返回撤销数量
+func (s *TradingService) CancelAllOrders(userID, marketID uint) (int, error) {
+	if _, err := s.marketRepo.FindByID(marketID); err != nil {
+		return 0, err
+	}
+
+	return s.cancelOpenOrders(marketID, func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", userID)
+	}, "user_cancelled")
+}
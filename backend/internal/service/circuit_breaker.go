@@ -0,0 +1,402 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// 熔断相关配置键（全局默认值）
+const (
+	configBreakerPriceMove       = "breaker_price_move"
+	configBreakerWindowMinutes   = "breaker_window_minutes"
+	configBreakerCooldownMinutes = "breaker_cooldown_minutes"
+	configBreakerScope           = "breaker_scope"
+)
+
+// 熔断范围
+const (
+	BreakerScopeOutcome = "outcome" // 仅暂停价格异动的结果选项
+	BreakerScopeMarket  = "market"  // 暂停整个市场
+)
+
+// 暂停交易错误
+var (
+	ErrMarketHalted  = errors.New("market is halted")
+	ErrOutcomeHalted = errors.New("outcome is halted")
+)
+
+// breakerSettings 市场生效的熔断参数，PriceMove 为 0 表示不启用熔断
+type breakerSettings struct {
+	PriceMove float64
+	Window    time.Duration
+	Cooldown  time.Duration // 0 表示只能由管理员恢复
+	Scope     string
+}
+
+// loadBreakerSettings 读取市场的熔断参数，市场未设置的项使用全局默认值
+func loadBreakerSettings(db *gorm.DB, market *model.Market) (breakerSettings, error) {
+	settings := breakerSettings{
+		PriceMove: market.BreakerPriceMove,
+		Window:    time.Duration(market.BreakerWindowMinutes) * time.Minute,
+		Cooldown:  time.Duration(market.BreakerCooldownMinutes) * time.Minute,
+		Scope:     market.BreakerScope,
+	}
+
+	if settings.PriceMove <= 0 {
+		v, err := configFloat(db, configBreakerPriceMove, 0)
+		if err != nil {
+			return settings, err
+		}
+		settings.PriceMove = v
+	}
+	if settings.Window <= 0 {
+		v, err := configFloat(db, configBreakerWindowMinutes, 5)
+		if err != nil {
+			return settings, err
+		}
+		settings.Window = time.Duration(v * float64(time.Minute))
+	}
+	if settings.Cooldown <= 0 {
+		v, err := configFloat(db, configBreakerCooldownMinutes, 15)
+		if err != nil {
+			return settings, err
+		}
+		settings.Cooldown = time.Duration(v * float64(time.Minute))
+	}
+	if settings.Scope == "" {
+		v, err := configValue(db, configBreakerScope)
+		if err != nil {
+			return settings, err
+		}
+		settings.Scope = v
+	}
+	if settings.Scope != BreakerScopeMarket {
+		settings.Scope = BreakerScopeOutcome
+	}
+	return settings, nil
+}
+
+// validateBreakerConfig 校验熔断配置值，其他配置键直接通过
+func validateBreakerConfig(key, value string) error {
+	switch key {
+	case configBreakerPriceMove, configBreakerWindowMinutes, configBreakerCooldownMinutes:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		if v < 0 {
+			return errors.New("value must not be negative")
+		}
+	case configBreakerScope:
+		if value != BreakerScopeOutcome && value != BreakerScopeMarket {
+			return errors.New("breaker scope must be outcome or market")
+		}
+	}
+	return nil
+}
+
+// marketTradingError 市场不可下单时返回对应错误
+func marketTradingError(status string) error {
+	switch status {
+	case "active":
+		return nil
+	case "halted":
+		return ErrMarketHalted
+	default:
+		return errors.New("market is not active")
+	}
+}
+
+// checkCircuitBreakers 记录成交后所有结果选项的价格，并检查成交的结果选项 outcomeID 在检测窗口内的价格变动，
+// 超过阈值时在同一事务内暂停该结果选项或整个市场。before 为本次成交前的价格。
+// 只检查成交的结果选项：LMSR 下其他结果的价格随之反向变动（二元市场中幅度相同），
+// 一并检查会使 outcome 范围的熔断总是暂停所有结果，与 market 范围无异。
+func (s *TradingService) checkCircuitBreakers(tx *gorm.DB, market *model.Market, mm *marketMaker, before map[uint]float64, outcomeID uint) error {
+	if !mm.dirty {
+		return nil
+	}
+
+	now := time.Now()
+	ticks := make([]model.PriceHistory, len(mm.outcomes))
+	for i, outcome := range mm.outcomes {
+		ticks[i] = model.PriceHistory{
+			MarketID:  market.ID,
+			OutcomeID: outcome.ID,
+			Price:     outcome.CurrentPrice,
+			CreatedAt: now,
+		}
+	}
+	if err := tx.Create(&ticks).Error; err != nil {
+		return err
+	}
+
+	settings, err := loadBreakerSettings(tx, market)
+	if err != nil || settings.PriceMove <= 0 {
+		return err
+	}
+
+	var until *time.Time
+	if settings.Cooldown > 0 {
+		t := now.Add(settings.Cooldown)
+		until = &t
+	}
+
+	i, ok := mm.index[outcomeID]
+	if !ok {
+		return nil
+	}
+	outcome := &mm.outcomes[i]
+	if outcome.Status == "halted" {
+		return nil
+	}
+
+	// 检测窗口内的最高价与最低价，成交前价格视为窗口内的价格
+	var window struct {
+		Low  float64
+		High float64
+	}
+	if err := tx.Model(&model.PriceHistory{}).
+		Select("MIN(price) AS low, MAX(price) AS high").
+		Where("outcome_id = ? AND created_at >= ?", outcome.ID, now.Add(-settings.Window)).
+		Scan(&window).Error; err != nil {
+		return err
+	}
+	low := math.Min(window.Low, before[outcome.ID])
+	high := math.Max(window.High, before[outcome.ID])
+
+	reference, tripped := breakerTripped(outcome.CurrentPrice, low, high, settings.PriceMove)
+	if !tripped {
+		return nil
+	}
+
+	halt := &model.MarketHalt{
+		MarketID:       market.ID,
+		OutcomeID:      &outcome.ID,
+		Reason:         "circuit_breaker",
+		ReferencePrice: reference,
+		Price:          outcome.CurrentPrice,
+		HaltedAt:       now,
+		HaltedUntil:    until,
+	}
+	if settings.Scope == BreakerScopeMarket {
+		return haltMarket(tx, market.ID, halt)
+	}
+	return haltOutcome(tx, outcome, halt)
+}
+
+// breakerTripped 以窗口内离当前价格更远的最高价或最低价为参考价，变动超过 move 时触发熔断
+func breakerTripped(price, low, high, move float64) (float64, bool) {
+	reference := low
+	if high-price > price-low {
+		reference = high
+	}
+	return reference, math.Abs(price-reference) > move
+}
+
+// haltMarket 在事务内暂停整个市场并记录
+func haltMarket(tx *gorm.DB, marketID uint, halt *model.MarketHalt) error {
+	reason := "admin_halt"
+	if halt.Reason == "circuit_breaker" {
+		reason = halt.Reason
+	}
+	halted, err := transitionMarket(tx, marketID, "active", "halted", halt.HaltedBy, reason,
+		map[string]interface{}{"halted_until": halt.HaltedUntil})
+	if err != nil {
+		return err
+	}
+	if !halted {
+		return errors.New("only active markets can be halted")
+	}
+	return tx.Create(halt).Error
+}
+
+// haltOutcome 在事务内暂停单个结果选项并记录
+func haltOutcome(tx *gorm.DB, outcome *model.Outcome, halt *model.MarketHalt) error {
+	if err := tx.Model(&model.Outcome{}).
+		Where("id = ?", outcome.ID).
+		Updates(map[string]interface{}{
+			"status":       "halted",
+			"halted_until": halt.HaltedUntil,
+		}).Error; err != nil {
+		return err
+	}
+	outcome.Status = "halted"
+	outcome.HaltedUntil = halt.HaltedUntil
+	return tx.Create(halt).Error
+}
+
+// HaltMarket 管理员手动暂停市场或其中一个结果选项，duration 为 0 表示直到管理员恢复
+func (s *TradingService) HaltMarket(marketID uint, outcomeID *uint, duration time.Duration, adminID uint) error {
+	market, err := s.marketRepo.FindByID(marketID)
+	if err != nil {
+		return err
+	}
+	if market.Status != "active" {
+		return errors.New("only active markets can be halted")
+	}
+	if outcomeID != nil && !hasOutcome(market, *outcomeID) {
+		return errors.New("invalid outcome")
+	}
+
+	unlock := s.engine.lockMarket(marketID)
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	mm, err := loadMarketMaker(tx, market)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	now := time.Now()
+	halt := &model.MarketHalt{
+		MarketID: marketID,
+		Reason:   "admin",
+		HaltedBy: &adminID,
+		HaltedAt: now,
+	}
+	if duration > 0 {
+		until := now.Add(duration)
+		halt.HaltedUntil = &until
+	}
+
+	if outcomeID == nil {
+		err = haltMarket(tx, marketID, halt)
+	} else {
+		outcome := &mm.outcomes[mm.index[*outcomeID]]
+		if outcome.Status == "halted" {
+			tx.Rollback()
+			return ErrOutcomeHalted
+		}
+		halt.OutcomeID = outcomeID
+		halt.ReferencePrice = outcome.CurrentPrice
+		halt.Price = outcome.CurrentPrice
+		err = haltOutcome(tx, outcome, halt)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// ResumeMarket 管理员恢复市场及其所有暂停的结果选项
+func (s *TradingService) ResumeMarket(marketID uint, adminID uint) error {
+	resumed, err := s.resumeMarket(marketID, nil, &adminID, "admin")
+	if err != nil {
+		return err
+	}
+	if resumed == 0 {
+		return errors.New("market has nothing halted")
+	}
+	return nil
+}
+
+// resumeMarket 恢复市场及其暂停的结果选项，返回恢复的数量。
+// expiredBefore 非空时只恢复冷却期在该时间前结束的暂停；条件更新保证多实例下不会重复恢复。
+func (s *TradingService) resumeMarket(marketID uint, expiredBefore *time.Time, resumedBy *uint, reason string) (int64, error) {
+	unlock := s.engine.lockMarket(marketID)
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockMarketRows(tx, marketID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	// scope 限定只恢复冷却期已结束的暂停
+	scope := func(db *gorm.DB) *gorm.DB {
+		if expiredBefore != nil {
+			return db.Where("halted_until <= ?", *expiredBefore)
+		}
+		return db
+	}
+
+	var resumed int64
+	var market model.Market
+	if err := tx.Select("id", "status", "halted_until").First(&market, marketID).Error; err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	expired := expiredBefore == nil || (market.HaltedUntil != nil && !market.HaltedUntil.After(*expiredBefore))
+	if market.Status == "halted" && expired {
+		statusReason := reason
+		if reason == "admin" {
+			statusReason = "admin_resume"
+		}
+		ok, err := transitionMarket(tx, marketID, "halted", "active", resumedBy, statusReason,
+			map[string]interface{}{"halted_until": nil})
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if ok {
+			resumed++
+		}
+	}
+
+	result := scope(tx.Model(&model.Outcome{}).Where("market_id = ? AND status = ?", marketID, "halted")).
+		Updates(map[string]interface{}{"status": "active", "halted_until": nil})
+	if result.Error != nil {
+		tx.Rollback()
+		return 0, result.Error
+	}
+	resumed += result.RowsAffected
+
+	if err := scope(tx.Model(&model.MarketHalt{}).Where("market_id = ? AND resumed_at IS NULL", marketID)).
+		Updates(map[string]interface{}{
+			"resumed_at":    time.Now(),
+			"resumed_by":    resumedBy,
+			"resume_reason": reason,
+		}).Error; err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+
+	if resumed > 0 {
+		// 暂停期间未处理的条件单
+		go s.evaluateConditionalOrders(marketID)
+	}
+	return resumed, nil
+}
+
+// resumeExpiredHalts 恢复冷却期已结束的熔断暂停
+func (s *TradingService) resumeExpiredHalts() {
+	now := time.Now()
+
+	marketIDs, err := s.marketRepo.FindMarketsWithExpiredHalts(now)
+	if err != nil {
+		log.Printf("Failed to find expired halts: %v", err)
+		return
+	}
+	for _, marketID := range marketIDs {
+		if _, err := s.resumeMarket(marketID, &now, nil, "cooldown"); err != nil {
+			log.Printf("Failed to resume market %d: %v", marketID, err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package service
+
+import "testing"
+
+func TestBreakerTripped(t *testing.T) {
+	for _, tc := range []struct {
+		price, low, high, move float64
+		reference              float64
+		tripped                bool
+	}{
+		{0.75, 0.5, 0.75, 0.2, 0.5, true},  // 上涨 25 点
+		{0.3, 0.3, 0.45, 0.2, 0.45, false}, // 下跌 15 点
+		{0.2, 0.2, 0.45, 0.2, 0.45, true},  // 下跌 25 点
+		{0.6, 0.5, 0.7, 0.2, 0.5, false},   // 窗口内来回波动
+		{0.7, 0.5, 0.7, 0.2, 0.5, false},   // 恰好等于阈值不触发
+	} {
+		reference, tripped := breakerTripped(tc.price, tc.low, tc.high, tc.move)
+		if tripped != tc.tripped || (tripped && reference != tc.reference) {
+			t.Errorf("price %v in [%v, %v]: reference %v tripped %v, want %v %v",
+				tc.price, tc.low, tc.high, reference, tripped, tc.reference, tc.tripped)
+		}
+	}
+}
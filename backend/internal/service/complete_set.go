@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// ErrSetsTooSmall 完整份额组数量对应的积分不足一分
+var ErrSetsTooSmall = errors.New("sets amount is too small to be worth at least 0.01")
+
+// completeSetCash 完整份额组 sets 份对应的积分：铸造按分向上取整，赎回按分向下取整，
+// 积分字段只保留两位小数，反复铸造与赎回不能凭取整获利。取整后为 0 时返回 ErrSetsTooSmall。
+func completeSetCash(sets float64, mint bool) (float64, error) {
+	cash := floorCents(sets)
+	if mint {
+		cash = ceilCents(sets)
+	}
+	if cash <= 0 {
+		return 0, ErrSetsTooSmall
+	}
+	return cash, nil
+}
+
+// MintCompleteSet 铸造完整份额组：支付 sets 积分（按分向上取整），获得市场内每个结果各 sets 份
+func (s *TradingService) MintCompleteSet(userID, marketID uint, sets float64) (float64, error) {
+	cost, err := completeSetCash(sets, true)
+	if err != nil {
+		return 0, err
+	}
+
+	market, err := s.marketRepo.FindByID(marketID)
+	if err != nil {
+		return 0, err
+	}
+	if err := marketTradingError(market.Status); err != nil {
+		return 0, err
+	}
+
+	return s.completeSetTx(market, func(tx *gorm.DB, mm *marketMaker) (float64, error) {
+		balance, err := s.adjustBalance(tx, userID, -cost)
+		if err != nil {
+			return 0, err
+		}
+
+		// 按当前价格分摊成本，各结果成本价之和为 1
+		prices := mm.prices()
+		outcomeIDs := make([]uint, 0, len(mm.outcomes))
+		for _, outcome := range mm.outcomes {
+			if err := s.updatePosition(tx, userID, marketID, outcome.ID, "buy", sets, prices[outcome.ID]); err != nil {
+				return 0, err
+			}
+			outcomeIDs = append(outcomeIDs, outcome.ID)
+		}
+
+		limits, err := loadPositionLimits(tx, market)
+		if err != nil {
+			return 0, err
+		}
+		if err := limits.checkExposure(tx, userID, marketID, outcomeIDs); err != nil {
+			return 0, err
+		}
+
+		if err := tx.Create(&model.Transaction{
+			UserID:       userID,
+			Type:         "set_mint",
+			Amount:       -cost,
+			BalanceAfter: balance,
+			MarketID:     &marketID,
+			Description:  fmt.Sprintf("Mint %.4f complete sets", sets),
+		}).Error; err != nil {
+			return 0, err
+		}
+		return balance, addTotalShares(tx, marketID, sets)
+	})
+}
+
+// RedeemCompleteSet 赎回完整份额组：交回市场内每个结果各 sets 份，获得 sets 积分（按分向下取整）
+func (s *TradingService) RedeemCompleteSet(userID, marketID uint, sets float64) (float64, error) {
+	proceeds, err := completeSetCash(sets, false)
+	if err != nil {
+		return 0, err
+	}
+
+	market, err := s.marketRepo.FindByID(marketID)
+	if err != nil {
+		return 0, err
+	}
+	if market.Status != "active" && market.Status != "halted" && market.Status != "closed" {
+		return 0, errors.New("complete sets can only be redeemed before resolution")
+	}
+
+	return s.completeSetTx(market, func(tx *gorm.DB, mm *marketMaker) (float64, error) {
+		for _, outcome := range mm.outcomes {
+			var position model.Position
+			err := tx.Where("user_id = ? AND market_id = ? AND outcome_id = ?", userID, marketID, outcome.ID).
+				First(&position).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && position.Shares-position.LockedShares < sets) {
+				return 0, errors.New("insufficient shares to redeem complete sets")
+			}
+			if err != nil {
+				return 0, err
+			}
+			if err := s.updatePosition(tx, userID, marketID, outcome.ID, "sell", sets, 0); err != nil {
+				return 0, err
+			}
+		}
+
+		balance, err := s.adjustBalance(tx, userID, proceeds)
+		if err != nil {
+			return 0, err
+		}
+		if err := tx.Create(&model.Transaction{
+			UserID:       userID,
+			Type:         "set_redeem",
+			Amount:       proceeds,
+			BalanceAfter: balance,
+			MarketID:     &marketID,
+			Description:  fmt.Sprintf("Redeem %.4f complete sets", sets),
+		}).Error; err != nil {
+			return 0, err
+		}
+		return balance, addTotalShares(tx, marketID, -sets)
+	})
+}
+
+// completeSetTx 在锁定市场的事务内执行完整份额组操作，返回用户余额
+func (s *TradingService) completeSetTx(market *model.Market, fn func(tx *gorm.DB, mm *marketMaker) (float64, error)) (float64, error) {
+	unlock := s.engine.lockMarket(market.ID)
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	mm, err := loadMarketMaker(tx, market)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	balance, err := fn(tx, mm)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return balance, tx.Commit().Error
+}
+
+// addTotalShares 调整市场内所有结果选项的流通份额
+func addTotalShares(tx *gorm.DB, marketID uint, shares float64) error {
+	return tx.Model(&model.Outcome{}).
+		Where("market_id = ?", marketID).
+		UpdateColumn("total_shares", gorm.Expr("total_shares + ?", shares)).Error
+}
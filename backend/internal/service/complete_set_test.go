@@ -0,0 +1,41 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompleteSetCashRounding(t *testing.T) {
+	for _, tc := range []struct {
+		sets, mint, redeem float64
+	}{
+		{1, 1, 1},
+		{2.5, 2.5, 2.5},
+		{1.005, 1.01, 1},
+		{0.019, 0.02, 0.01},
+		{0.01, 0.01, 0.01},
+	} {
+		mint, err := completeSetCash(tc.sets, true)
+		if err != nil || mint != tc.mint {
+			t.Errorf("mint %v sets: %v, %v, want %v", tc.sets, mint, err, tc.mint)
+		}
+		redeem, err := completeSetCash(tc.sets, false)
+		if err != nil || redeem != tc.redeem {
+			t.Errorf("redeem %v sets: %v, %v, want %v", tc.sets, redeem, err, tc.redeem)
+		}
+		// 铸造后立即赎回不能获利
+		if redeem > mint {
+			t.Errorf("%v sets: redeem %v pays more than mint %v costs", tc.sets, redeem, mint)
+		}
+	}
+}
+
+func TestCompleteSetCashRejectsSubCent(t *testing.T) {
+	// 0.005 份铸造需一分，但赎回不足一分，拒绝以免反复操作凭存储取整获利
+	if _, err := completeSetCash(0.005, false); !errors.Is(err, ErrSetsTooSmall) {
+		t.Errorf("redeem 0.005 sets: %v, want ErrSetsTooSmall", err)
+	}
+	if _, err := completeSetCash(0.0001, true); err != nil {
+		t.Errorf("mint 0.0001 sets: %v, want a one-cent charge", err)
+	}
+}
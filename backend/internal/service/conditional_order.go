@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// maxTriggerRounds 单次价格变动后连锁触发条件单的最大轮数
+const maxTriggerRounds = 10
+
+// ConditionalOrderParams 条件单参数
+type ConditionalOrderParams struct {
+	MarketID         uint
+	OutcomeID        uint
+	OrderType        string
+	OrderKind        string // 触发后的下单类型，为空时按 market 处理
+	Shares           float64
+	Price            float64 // 限价；市价单为最差价格，0 表示不限制
+	TriggerPrice     float64
+	TriggerDirection string // below, above
+}
+
+// CreateConditionalOrder 创建止损 / 止盈条件单
+func (s *TradingService) CreateConditionalOrder(userID uint, params ConditionalOrderParams) (*model.ConditionalOrder, error) {
+	if params.OrderKind == "" {
+		params.OrderKind = OrderKindMarket
+	}
+	if params.OrderKind == OrderKindLimit && params.Price <= 0 {
+		return nil, errors.New("limit conditional orders require a price")
+	}
+	if params.TriggerDirection != "below" && params.TriggerDirection != "above" {
+		return nil, errors.New("trigger_direction must be below or above")
+	}
+
+	market, err := s.marketRepo.FindByID(params.MarketID)
+	if err != nil {
+		return nil, err
+	}
+	if market.Status != "active" && market.Status != "halted" {
+		return nil, errors.New("market is not active")
+	}
+	if !hasOutcome(market, params.OutcomeID) {
+		return nil, errors.New("invalid outcome")
+	}
+
+	// 卖出条件单需要持有对应份额
+	if params.OrderType == "sell" {
+		position, err := s.positionRepo.FindByUserAndOutcome(userID, params.MarketID, params.OutcomeID)
+		if err != nil {
+			return nil, err
+		}
+		if position == nil || position.Shares < params.Shares {
+			return nil, errors.New("insufficient shares")
+		}
+	}
+
+	order := &model.ConditionalOrder{
+		UserID:           userID,
+		MarketID:         params.MarketID,
+		OutcomeID:        params.OutcomeID,
+		OrderType:        params.OrderType,
+		OrderKind:        params.OrderKind,
+		Shares:           params.Shares,
+		Price:            params.Price,
+		TriggerPrice:     params.TriggerPrice,
+		TriggerDirection: params.TriggerDirection,
+		Status:           "active",
+	}
+	if err := s.orderRepo.CreateConditional(order); err != nil {
+		return nil, err
+	}
+
+	// 当前价格可能已满足触发条件
+	go s.evaluateConditionalOrders(params.MarketID)
+
+	return order, nil
+}
+
+// GetUserConditionalOrders 获取用户条件单列表
+func (s *TradingService) GetUserConditionalOrders(userID uint, page, pageSize int) ([]model.ConditionalOrder, int64, error) {
+	return s.orderRepo.FindConditionalByUserID(userID, page, pageSize)
+}
+
+// CancelConditionalOrder 取消条件单
+func (s *TradingService) CancelConditionalOrder(id, userID uint) error {
+	var order model.ConditionalOrder
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("conditional order not found")
+		}
+		return err
+	}
+
+	ok, err := s.orderRepo.UpdateConditionalStatus(id, "active", map[string]interface{}{
+		"status":        "cancelled",
+		"status_reason": "user_cancelled",
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("conditional order cannot be cancelled")
+	}
+	return nil
+}
+
+// evaluateConditionalOrders 价格变动后检查并触发条件单，触发产生的成交可能继续触发其他条件单
+func (s *TradingService) evaluateConditionalOrders(marketID uint) {
+	for round := 0; round < maxTriggerRounds; round++ {
+		triggered, err := s.triggerConditionalOrders(marketID)
+		if err != nil {
+			log.Printf("Failed to evaluate conditional orders in market %d: %v", marketID, err)
+			return
+		}
+		if triggered == 0 {
+			return
+		}
+	}
+}
+
+// triggerConditionalOrders 按当前价格触发一轮条件单，返回触发数量
+func (s *TradingService) triggerConditionalOrders(marketID uint) (int, error) {
+	orders, err := s.orderRepo.FindActiveConditionalByMarket(marketID)
+	if err != nil || len(orders) == 0 {
+		return 0, err
+	}
+
+	market, err := s.marketRepo.FindByID(marketID)
+	if err != nil {
+		return 0, err
+	}
+	// 暂停期间不触发，恢复交易后重新检查
+	if market.Status != "active" {
+		return 0, nil
+	}
+	prices := make(map[uint]float64, len(market.Outcomes))
+	halted := make(map[uint]bool)
+	for _, outcome := range market.Outcomes {
+		prices[outcome.ID] = outcome.CurrentPrice
+		halted[outcome.ID] = outcome.Status == "halted"
+	}
+
+	triggered := 0
+	for _, cond := range orders {
+		if halted[cond.OutcomeID] {
+			continue
+		}
+		price := prices[cond.OutcomeID]
+		if cond.TriggerDirection == "below" && price > cond.TriggerPrice {
+			continue
+		}
+		if cond.TriggerDirection == "above" && price < cond.TriggerPrice {
+			continue
+		}
+
+		// 先抢占状态，避免并发重复触发
+		now := time.Now()
+		ok, err := s.orderRepo.UpdateConditionalStatus(cond.ID, "active", map[string]interface{}{
+			"status":       "triggered",
+			"triggered_at": now,
+		})
+		if err != nil {
+			return triggered, err
+		}
+		if !ok {
+			continue
+		}
+		triggered++
+
+		order, err := s.placeOrder(cond.UserID, PlaceOrderParams{
+			MarketID:  cond.MarketID,
+			OutcomeID: cond.OutcomeID,
+			OrderType: cond.OrderType,
+			OrderKind: cond.OrderKind,
+			Shares:    cond.Shares,
+			Price:     cond.Price,
+		})
+		if err != nil {
+			if _, err := s.orderRepo.UpdateConditionalStatus(cond.ID, "triggered", map[string]interface{}{
+				"status":        "failed",
+				"status_reason": err.Error(),
+			}); err != nil {
+				return triggered, err
+			}
+			continue
+		}
+
+		if _, err := s.orderRepo.UpdateConditionalStatus(cond.ID, "triggered", map[string]interface{}{
+			"triggered_order_id": order.ID,
+		}); err != nil {
+			return triggered, err
+		}
+	}
+
+	return triggered, nil
+}
+
+// cancelConditionalOrders 撤销满足条件的生效中条件单
+func cancelConditionalOrders(db *gorm.DB, reason string, query string, args ...interface{}) error {
+	return db.Model(&model.ConditionalOrder{}).
+		Where("status = ?", "active").
+		Where(query, args...).
+		Updates(map[string]interface{}{
+			"status":        "cancelled",
+			"status_reason": reason,
+		}).Error
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"github.com/huabtc/polygame/backend/internal/repository"
+	"gorm.io/gorm"
+)
+
+// defaultSystemConfigs 系统配置项及默认值，启动时写入尚不存在的键
+var defaultSystemConfigs = []model.SystemConfig{
+	{Key: configFeeMakerRate, Value: "0", Type: "number", Category: "trading", Label: "Maker fee rate (fraction of notional)"},
+	{Key: configFeeTakerRate, Value: "0", Type: "number", Category: "trading", Label: "Taker fee rate (fraction of notional)"},
+	{Key: configFeeCategoryOverrides, Value: "{}", Type: "json", Category: "trading", Label: "Per-category fee rate overrides"},
+	{Key: configLimitMaxOrderShares, Value: "0", Type: "number", Category: "limits", Label: "Max shares per order (0 = unlimited)"},
+	{Key: configLimitMaxPositionShares, Value: "0", Type: "number", Category: "limits", Label: "Max shares per outcome per user (0 = unlimited)"},
+	{Key: configLimitMaxMarketNotional, Value: "0", Type: "number", Category: "limits", Label: "Max notional per market per user (0 = unlimited)"},
+	{Key: configBreakerPriceMove, Value: "0", Type: "number", Category: "circuit_breaker", Label: "Price move that trips the breaker (0 = disabled)"},
+	{Key: configBreakerWindowMinutes, Value: "5", Type: "number", Category: "circuit_breaker", Label: "Breaker detection window in minutes"},
+	{Key: configBreakerCooldownMinutes, Value: "15", Type: "number", Category: "circuit_breaker", Label: "Cooldown before automatic resume in minutes (0 = admin only)"},
+	{Key: configBreakerScope, Value: BreakerScopeOutcome, Type: "string", Category: "circuit_breaker", Label: "Breaker scope (outcome or market)"},
+	{Key: configResolutionDisputeWindowMinutes, Value: "0", Type: "number", Category: "resolution", Label: "Dispute window after a proposed resolution in minutes (0 = settle immediately)"},
+}
+
+type ConfigService struct {
+	configRepo *repository.ConfigRepository
+}
+
+func NewConfigService(configRepo *repository.ConfigRepository) *ConfigService {
+	return &ConfigService{configRepo: configRepo}
+}
+
+// SeedDefaults 写入默认配置（已存在的配置不会被覆盖）
+func (s *ConfigService) SeedDefaults() error {
+	configs := make([]model.SystemConfig, len(defaultSystemConfigs))
+	copy(configs, defaultSystemConfigs)
+	return s.configRepo.CreateIfNotExists(configs)
+}
+
+// ListConfigs 获取系统配置列表
+func (s *ConfigService) ListConfigs(category string) ([]model.SystemConfig, error) {
+	return s.configRepo.List(category)
+}
+
+// UpdateConfig 按配置类型校验并更新配置值
+func (s *ConfigService) UpdateConfig(key, value string) (*model.SystemConfig, error) {
+	config, err := s.configRepo.FindByKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Type {
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, errors.New("value must be a number")
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return nil, errors.New("value must be a boolean")
+		}
+	case "json":
+		if !json.Valid([]byte(value)) {
+			return nil, errors.New("value must be valid JSON")
+		}
+	}
+	if err := validateFeeConfig(key, value); err != nil {
+		return nil, err
+	}
+	if err := validateLimitConfig(key, value); err != nil {
+		return nil, err
+	}
+	if err := validateBreakerConfig(key, value); err != nil {
+		return nil, err
+	}
+	if err := validateResolutionConfig(key, value); err != nil {
+		return nil, err
+	}
+
+	if err := s.configRepo.UpdateValue(key, value); err != nil {
+		return nil, err
+	}
+	config.Value = value
+	return config, nil
+}
+
+// configValue 读取配置值，不存在时返回空字符串
+func configValue(db *gorm.DB, key string) (string, error) {
+	var config model.SystemConfig
+	err := db.Where("key = ?", key).Limit(1).Find(&config).Error
+	return config.Value, err
+}
+
+// configFloat 读取数值型配置，不存在或为空时返回默认值
+func configFloat(db *gorm.DB, key string, defaultValue float64) (float64, error) {
+	value, err := configValue(db, key)
+	if err != nil || value == "" {
+		return defaultValue, err
+	}
+	return strconv.ParseFloat(value, 64)
+}
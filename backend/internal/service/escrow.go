@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// roundCents 金额按分四舍五入，与 decimal(20,2) 的积分字段精度一致
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// ceilCents 金额按分向上取整（容忍浮点误差）
+func ceilCents(amount float64) float64 {
+	return math.Ceil(amount*100-1e-6) / 100
+}
+
+// floorCents 金额按分向下取整（容忍浮点误差）
+func floorCents(amount float64) float64 {
+	return math.Floor(amount*100+1e-6) / 100
+}
+
+// reservedFor 买单 shares 份额对应的冻结积分：按未成交份额的比例分摊订单当前的冻结额，
+// 覆盖全部未成交份额时为剩余的全部冻结额，避免逐笔重新计算造成的分位误差
+func reservedFor(order *model.Order, shares float64) float64 {
+	open := order.Shares - order.FilledShares
+	if shares >= open-shareEpsilon {
+		return order.ReservedAmount
+	}
+	return math.Min(roundCents(order.ReservedAmount*shares/open), order.ReservedAmount)
+}
+
+// reserveOrder 为挂单冻结资金（买单，含挂单手续费）或持仓份额（卖单）。
+// 买单的冻结额累加到 order.ReservedAmount，由调用方保存订单。
+func (s *TradingService) reserveOrder(tx *gorm.DB, order *model.Order, remaining float64) error {
+	if order.OrderType == "buy" {
+		amount := escrowAmount(order, remaining)
+		result := tx.Model(&model.User{}).
+			Where("id = ? AND virtual_balance >= ?", order.UserID, amount).
+			Updates(map[string]interface{}{
+				"virtual_balance":  gorm.Expr("virtual_balance - ?", amount),
+				"reserved_balance": gorm.Expr("reserved_balance + ?", amount),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("insufficient balance")
+		}
+		order.ReservedAmount += amount
+
+		balance, err := s.currentBalance(tx, order.UserID)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&model.Transaction{
+			UserID:       order.UserID,
+			Type:         "order_reserve",
+			Amount:       -amount,
+			BalanceAfter: balance,
+			OrderID:      &order.ID,
+			MarketID:     &order.MarketID,
+			Description:  "Reserve balance for resting order",
+		}).Error
+	}
+
+	result := tx.Model(&model.Position{}).
+		Where("user_id = ? AND market_id = ? AND outcome_id = ? AND shares - locked_shares >= ?",
+			order.UserID, order.MarketID, order.OutcomeID, remaining).
+		UpdateColumn("locked_shares", gorm.Expr("locked_shares + ?", remaining))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("insufficient shares")
+	}
+	return nil
+}
+
+// releaseOrder 释放挂单未成交部分冻结的资金或份额，并记录交易
+func (s *TradingService) releaseOrder(tx *gorm.DB, order *model.Order) error {
+	return s.releaseShares(tx, order, order.Shares-order.FilledShares)
+}
+
+// releaseShares 释放 remaining 份额对应的冻结资金（见 reservedFor）或份额，并记录交易。
+// 须在扣减订单份额之前调用，由调用方保存订单。
+func (s *TradingService) releaseShares(tx *gorm.DB, order *model.Order, remaining float64) error {
+	if remaining <= shareEpsilon {
+		return nil
+	}
+
+	if order.OrderType == "buy" {
+		return s.releaseReserved(tx, order, reservedFor(order, remaining), "Release reserved balance")
+	}
+
+	if err := tx.Model(&model.Position{}).
+		Where("user_id = ? AND market_id = ? AND outcome_id = ?", order.UserID, order.MarketID, order.OutcomeID).
+		UpdateColumn("locked_shares", gorm.Expr("locked_shares - ?", remaining)).Error; err != nil {
+		return err
+	}
+
+	balance, err := s.currentBalance(tx, order.UserID)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.Transaction{
+		UserID:       order.UserID,
+		Type:         "order_release",
+		Amount:       0,
+		BalanceAfter: balance,
+		OrderID:      &order.ID,
+		MarketID:     &order.MarketID,
+		Description:  fmt.Sprintf("Release %.4f locked shares", remaining),
+	}).Error
+}
+
+// releaseForFill 挂单买单成交时，从订单的冻结额中释放本笔成交的花费 cost（成交金额与手续费）到可用余额，
+// 成交完全部剩余份额时释放剩余的全部冻结额。随后由调用方像吃单一样扣款，交易记录与余额变动保持一致。
+func (s *TradingService) releaseForFill(tx *gorm.DB, order *model.Order, shares, cost float64) error {
+	return s.releaseReserved(tx, order, fillRelease(order, shares, cost), "Release reserved balance for fill")
+}
+
+// fillRelease 挂单买单成交 shares 份额、花费 cost 时应释放的冻结额（见 releaseForFill）
+func fillRelease(order *model.Order, shares, cost float64) float64 {
+	if shares >= order.Shares-order.FilledShares-shareEpsilon {
+		return order.ReservedAmount
+	}
+	return math.Min(cost, order.ReservedAmount)
+}
+
+// releaseReserved 将买单 amount 积分的冻结额转回可用余额，并记录 order_release 交易
+func (s *TradingService) releaseReserved(tx *gorm.DB, order *model.Order, amount float64, description string) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	order.ReservedAmount -= amount
+	if err := tx.Model(&model.User{}).
+		Where("id = ?", order.UserID).
+		Updates(map[string]interface{}{
+			"virtual_balance":  gorm.Expr("virtual_balance + ?", amount),
+			"reserved_balance": gorm.Expr("reserved_balance - ?", amount),
+		}).Error; err != nil {
+		return err
+	}
+
+	balance, err := s.currentBalance(tx, order.UserID)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.Transaction{
+		UserID:       order.UserID,
+		Type:         "order_release",
+		Amount:       amount,
+		BalanceAfter: balance,
+		OrderID:      &order.ID,
+		MarketID:     &order.MarketID,
+		Description:  description,
+	}).Error
+}
+
+// cancelOrderTx 在事务内锁定并取消挂单，释放冻结，返回被取消的订单
+func (s *TradingService) cancelOrderTx(tx *gorm.DB, orderID uint, reason string) (*model.Order, error) {
+	var order model.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("order not found")
+		}
+		return nil, err
+	}
+	if order.Status != "pending" && order.Status != "partially_filled" {
+		return nil, errors.New("order cannot be cancelled")
+	}
+
+	if err := s.cancelLockedOrder(tx, &order, reason); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// cancelLockedOrder 取消已在事务内锁定的挂单并释放冻结
+func (s *TradingService) cancelLockedOrder(tx *gorm.DB, order *model.Order, reason string) error {
+	if err := s.releaseOrder(tx, order); err != nil {
+		return err
+	}
+	order.Status = "cancelled"
+	order.StatusReason = reason
+	return tx.Save(order).Error
+}
+
+// currentBalance 在事务内读取用户可用余额
+func (s *TradingService) currentBalance(tx *gorm.DB, userID uint) (float64, error) {
+	var user model.User
+	if err := tx.Select("virtual_balance").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	return user.VirtualBalance, nil
+}
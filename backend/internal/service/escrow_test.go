@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+)
+
+func TestCentRounding(t *testing.T) {
+	for _, tc := range []struct {
+		amount, round, ceil, floor float64
+	}{
+		{1.234, 1.23, 1.24, 1.23},
+		{1.235, 1.24, 1.24, 1.23},
+		{0.005, 0.01, 0.01, 0},
+		{0.1 + 0.2, 0.3, 0.3, 0.3}, // 浮点误差不应多取或少取一分
+		{2, 2, 2, 2},
+	} {
+		if got := roundCents(tc.amount); got != tc.round {
+			t.Errorf("roundCents(%v) = %v, want %v", tc.amount, got, tc.round)
+		}
+		if got := ceilCents(tc.amount); got != tc.ceil {
+			t.Errorf("ceilCents(%v) = %v, want %v", tc.amount, got, tc.ceil)
+		}
+		if got := floorCents(tc.amount); got != tc.floor {
+			t.Errorf("floorCents(%v) = %v, want %v", tc.amount, got, tc.floor)
+		}
+	}
+}
+
+func TestReservedForSplitsProRata(t *testing.T) {
+	order := &model.Order{Shares: 3, FilledShares: 0, ReservedAmount: 1.00}
+
+	if got := reservedFor(order, 1); got != 0.33 {
+		t.Errorf("one of three shares: %v, want 0.33", got)
+	}
+	// 覆盖全部未成交份额时释放剩余的全部冻结额，不因逐笔取整留下零头
+	if got := reservedFor(order, 3); got != 1.00 {
+		t.Errorf("all shares: %v, want 1.00", got)
+	}
+
+	order.FilledShares = 2
+	order.ReservedAmount = 0.34
+	if got := reservedFor(order, 1); got != 0.34 {
+		t.Errorf("last share: %v, want 0.34", got)
+	}
+}
+
+func TestFillReleaseCapsAtReserved(t *testing.T) {
+	order := &model.Order{Shares: 10, FilledShares: 4, ReservedAmount: 3.06}
+
+	if got := fillRelease(order, 2, 1.02); got != 1.02 {
+		t.Errorf("partial fill: %v, want the fill cost 1.02", got)
+	}
+	if got := fillRelease(order, 2, 5); got != 3.06 {
+		t.Errorf("cost above reserve: %v, want the reserve 3.06", got)
+	}
+	if got := fillRelease(order, 6, 2.5); got != 3.06 {
+		t.Errorf("final fill: %v, want the whole reserve 3.06", got)
+	}
+}
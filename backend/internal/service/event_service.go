@@ -0,0 +1,129 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"github.com/huabtc/polygame/backend/internal/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type EventService struct {
+	eventRepo *repository.EventRepository
+	markets   *MarketService
+}
+
+func NewEventService(eventRepo *repository.EventRepository, markets *MarketService) *EventService {
+	return &EventService{
+		eventRepo: eventRepo,
+		markets:   markets,
+	}
+}
+
+// CreateEvent 创建赛事（管理员）
+func (s *EventService) CreateEvent(event *model.Event) error {
+	return s.eventRepo.Create(event)
+}
+
+// GetEvent 获取赛事详情，包含其所有市场
+func (s *EventService) GetEvent(eventID uint) (*model.Event, error) {
+	return s.eventRepo.FindByID(eventID)
+}
+
+// ListEvents 获取赛事列表
+func (s *EventService) ListEvents(category string, page, pageSize int) ([]model.Event, int64, error) {
+	return s.eventRepo.List(category, page, pageSize)
+}
+
+// UpdateEvent 更新赛事（管理员），不影响其下的市场
+func (s *EventService) UpdateEvent(event *model.Event) error {
+	return s.eventRepo.Update(event)
+}
+
+// CloseEvent 关闭赛事下所有交易中（active / halted）的市场并撤销其挂单（管理员），返回被关闭的市场。
+// 所有市场在同一事务内关闭，任一市场失败时全部回滚，错误中注明失败的市场。
+func (s *EventService) CloseEvent(eventID, adminID uint) ([]uint, error) {
+	closed := []uint{}
+	err := s.eventTx(eventID, func(tx *gorm.DB, market *model.Market) error {
+		if market.Status != "active" && market.Status != "halted" {
+			return nil
+		}
+		ok, err := s.markets.closeMarketTx(tx, market.ID, &adminID, "event_close")
+		if err != nil {
+			return fmt.Errorf("close market %d: %w", market.ID, err)
+		}
+		if ok {
+			closed = append(closed, market.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return closed, nil
+}
+
+// CancelEvent 取消赛事下所有尚未结算或取消的市场，并按 basis 为持仓退款（管理员）。
+// 所有市场在同一事务内取消，任一市场失败时全部回滚，错误中注明失败的市场。
+func (s *EventService) CancelEvent(eventID, adminID uint, basis string) ([]MarketRefund, error) {
+	refunds := []MarketRefund{}
+	err := s.eventTx(eventID, func(tx *gorm.DB, market *model.Market) error {
+		if checkMarketTransition(market.Status, "cancelled") != nil {
+			return nil
+		}
+		refund, err := s.markets.trading.cancelMarketTx(tx, market.ID, adminID, basis, "event_cancel")
+		if err != nil {
+			return fmt.Errorf("cancel market %d: %w", market.ID, err)
+		}
+		refunds = append(refunds, *refund)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// eventTx 锁定赛事下所有市场，在单个事务内按市场 ID 升序对每个市场执行 fn，任一市场出错时整体回滚
+func (s *EventService) eventTx(eventID uint, fn func(tx *gorm.DB, market *model.Market) error) error {
+	event, err := s.eventRepo.FindByID(eventID)
+	if err != nil {
+		return err
+	}
+	marketIDs := make([]uint, 0, len(event.Markets))
+	for _, market := range event.Markets {
+		marketIDs = append(marketIDs, market.ID)
+	}
+
+	unlock := s.markets.trading.engine.lockMarkets(marketIDs)
+	defer unlock()
+
+	// 开始事务
+	tx := s.markets.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 锁定赛事行，与加入赛事的市场串行（见 lockGroupJoin）
+	if _, err := loadEvent(tx.Clauses(clause.Locking{Strength: "UPDATE"}), eventID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var markets []model.Market
+	if err := tx.Select("id", "status").Where("event_id = ?", eventID).Order("id ASC").Find(&markets).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i := range markets {
+		if err := fn(tx, &markets[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"github.com/huabtc/polygame/backend/internal/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 手续费相关配置键
+const (
+	configFeeMakerRate         = "fee_maker_rate"
+	configFeeTakerRate         = "fee_taker_rate"
+	configFeeCategoryOverrides = "fee_category_overrides" // {"sports": {"maker_rate": 0.001, "taker_rate": 0.02}}
+)
+
+// feeTreasuryAccount 手续费收入计入的平台金库账户
+const feeTreasuryAccount = "fees"
+
+// feeRates 挂单（maker）与吃单（taker）费率，均为成交金额的比例
+type feeRates struct {
+	MakerRate float64
+	TakerRate float64
+}
+
+// feeOverride 分类费率覆盖，未设置的一项沿用全局费率
+type feeOverride struct {
+	MakerRate *float64 `json:"maker_rate"`
+	TakerRate *float64 `json:"taker_rate"`
+}
+
+// loadFeeRates 读取市场分类适用的费率
+func loadFeeRates(db *gorm.DB, category string) (feeRates, error) {
+	var rates feeRates
+	var err error
+	if rates.MakerRate, err = configFloat(db, configFeeMakerRate, 0); err != nil {
+		return rates, err
+	}
+	if rates.TakerRate, err = configFloat(db, configFeeTakerRate, 0); err != nil {
+		return rates, err
+	}
+
+	value, err := configValue(db, configFeeCategoryOverrides)
+	if err != nil || value == "" {
+		return rates, err
+	}
+	var overrides map[string]feeOverride
+	if err := json.Unmarshal([]byte(value), &overrides); err != nil {
+		return rates, err
+	}
+	if override, ok := overrides[category]; ok {
+		if override.MakerRate != nil {
+			rates.MakerRate = *override.MakerRate
+		}
+		if override.TakerRate != nil {
+			rates.TakerRate = *override.TakerRate
+		}
+	}
+	return rates, nil
+}
+
+// validateFeeRate 费率必须在 [0, 1) 之间
+func validateFeeRate(rate float64) error {
+	if rate < 0 || rate >= 1 {
+		return errors.New("fee rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// validateFeeConfig 校验手续费配置值，其他配置键直接通过
+func validateFeeConfig(key, value string) error {
+	switch key {
+	case configFeeMakerRate, configFeeTakerRate:
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		return validateFeeRate(rate)
+	case configFeeCategoryOverrides:
+		var overrides map[string]feeOverride
+		if err := json.Unmarshal([]byte(value), &overrides); err != nil {
+			return errors.New("fee overrides must map categories to maker_rate / taker_rate")
+		}
+		for _, override := range overrides {
+			for _, rate := range []*float64{override.MakerRate, override.TakerRate} {
+				if rate == nil {
+					continue
+				}
+				if err := validateFeeRate(*rate); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// escrowAmount 买单挂单份额需冻结的积分，包含成交时的挂单手续费，按分向上取整
+func escrowAmount(order *model.Order, shares float64) float64 {
+	return ceilCents(shares * order.Price * (1 + order.MakerFeeRate))
+}
+
+// feeFor 成交金额 notional 按费率计算的手续费，按分四舍五入
+func feeFor(notional, rate float64) float64 {
+	return roundCents(notional * rate)
+}
+
+// chargeFee 收取手续费（已按分取整，见 feeFor）：从可用余额扣除，记录 trade_fee 交易并以相同金额计入平台金库
+func (s *TradingService) chargeFee(tx *gorm.DB, order *model.Order, fee float64) error {
+	if fee <= 0 {
+		return nil
+	}
+
+	balance, err := s.adjustBalance(tx, order.UserID, -fee)
+	if err != nil {
+		return err
+	}
+
+	order.FeesPaid += fee
+	if err := tx.Create(&model.Transaction{
+		UserID:       order.UserID,
+		Type:         "trade_fee",
+		Amount:       -fee,
+		BalanceAfter: balance,
+		OrderID:      &order.ID,
+		MarketID:     &order.MarketID,
+		Description:  "Trading fee",
+	}).Error; err != nil {
+		return err
+	}
+
+	return creditTreasury(tx, feeTreasuryAccount, fee)
+}
+
+// creditTreasury 增加平台金库账户余额（账户不存在时创建）
+func creditTreasury(tx *gorm.DB, name string, amount float64) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "name"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"balance":    gorm.Expr("treasury_accounts.balance + ?", amount),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&model.TreasuryAccount{Name: name, Balance: amount}).Error
+}
+
+// FeeReport 手续费报表
+type FeeReport struct {
+	TreasuryBalance float64                   `json:"treasury_balance"`
+	TotalFees       float64                   `json:"total_fees"`
+	Rows            []repository.FeeReportRow `json:"rows"`
+}
+
+// GetFeeReport 按市场和日期汇总手续费收入，marketID 为 0 表示所有市场
+func (s *TradingService) GetFeeReport(from, to time.Time, marketID uint) (*FeeReport, error) {
+	rows, err := s.txRepo.FeeReport(from, to, marketID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FeeReport{Rows: rows}
+	for _, row := range rows {
+		report.TotalFees += row.TotalFees
+	}
+
+	var account model.TreasuryAccount
+	if err := s.db.Where("name = ?", feeTreasuryAccount).Limit(1).Find(&account).Error; err != nil {
+		return nil, err
+	}
+	report.TreasuryBalance = account.Balance
+
+	return report, nil
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+)
+
+func TestFeeForRoundsOnce(t *testing.T) {
+	for _, tc := range []struct {
+		notional, rate, fee float64
+	}{
+		{100, 0.02, 2},
+		{0.3, 0.02, 0.01},   // 0.006 四舍五入为一分
+		{0.2, 0.02, 0},      // 0.004 不足半分
+		{33.33, 0.015, 0.5}, // 0.49995
+		{10, 0, 0},
+	} {
+		if got := feeFor(tc.notional, tc.rate); got != tc.fee {
+			t.Errorf("feeFor(%v, %v) = %v, want %v", tc.notional, tc.rate, got, tc.fee)
+		}
+	}
+}
+
+func TestEscrowAmountRoundsUp(t *testing.T) {
+	order := &model.Order{Price: 0.333, MakerFeeRate: 0.01}
+	// 3 × 0.333 × 1.01 = 1.00899，向上取整保证冻结额足以支付成交与手续费
+	if got := escrowAmount(order, 3); got != 1.01 {
+		t.Errorf("escrowAmount = %v, want 1.01", got)
+	}
+	order.MakerFeeRate = 0
+	if got := escrowAmount(order, 3); got != 1.00 {
+		t.Errorf("escrowAmount without fee = %v, want 1.00", got)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrIdempotencyKeyReused 同一幂等键被用于不同的下单请求
+var ErrIdempotencyKeyReused = errors.New("idempotency key already used with a different request")
+
+// errIdempotencyKeyClaimed 幂等键已被并发的相同请求占用，调用方应回滚并返回原订单
+var errIdempotencyKeyClaimed = errors.New("idempotency key already claimed")
+
+// requestHash 下单参数摘要，用于判断幂等键是否被不同请求复用
+func (p PlaceOrderParams) requestHash() string {
+	var expiresAt int64
+	if p.ExpiresAt != nil {
+		expiresAt = p.ExpiresAt.Unix()
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%d|%s|%s|%g|%g|%g|%g|%g|%s|%d|%s",
+		p.MarketID, p.OutcomeID, p.OrderType, p.OrderKind, p.Shares, p.Price, p.Budget,
+		p.MaxCost, p.MinProceeds, p.TimeInForce, expiresAt, p.SelfTradePrevention)))
+	return hex.EncodeToString(sum[:])
+}
+
+// replayIdempotentOrder 幂等键已存在时返回首次请求返回的订单，请求不一致时返回 ErrIdempotencyKeyReused；
+// 幂等键不存在或已过期时返回 nil, nil
+func (s *TradingService) replayIdempotentOrder(userID uint, params PlaceOrderParams) (*model.Order, error) {
+	record, err := s.orderRepo.FindIdempotencyKey(userID, params.IdempotencyKey)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	if record.RequestHash != params.requestHash() {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	var order model.Order
+	if err := json.Unmarshal([]byte(record.Response), &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// claimIdempotencyKey 在下单事务内登记幂等键，键已被占用时返回 false
+func (s *TradingService) claimIdempotencyKey(tx *gorm.DB, userID, orderID uint, params PlaceOrderParams) (bool, error) {
+	now := time.Now()
+
+	// 清理该用户已过期的幂等键，使过期的键可以重新使用
+	if err := tx.Where("user_id = ? AND expires_at <= ?", userID, now).
+		Delete(&model.IdempotencyKey{}).Error; err != nil {
+		return false, err
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.IdempotencyKey{
+		UserID:      userID,
+		Key:         params.IdempotencyKey,
+		RequestHash: params.requestHash(),
+		OrderID:     orderID,
+		ExpiresAt:   now.Add(s.cfg.Trading.IdempotencyTTL),
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// saveIdempotentResponse 在下单事务内记录幂等键对应的响应订单，供重复请求原样返回
+func saveIdempotentResponse(tx *gorm.DB, userID uint, key string, order *model.Order) error {
+	response, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&model.IdempotencyKey{}).
+		Where("user_id = ? AND key = ?", userID, key).
+		Update("response", string(response)).Error
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// 持仓限制相关配置键（全局默认值，0 表示不限制）
+const (
+	configLimitMaxOrderShares    = "limit_max_order_shares"
+	configLimitMaxPositionShares = "limit_max_position_shares"
+	configLimitMaxMarketNotional = "limit_max_market_notional"
+)
+
+// LimitError 持仓限制错误，Code 供客户端区分拒单原因
+type LimitError struct {
+	Code    string
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+// 持仓限制错误
+var (
+	ErrOrderSizeLimit = &LimitError{
+		Code:    "order_size_limit_exceeded",
+		Message: "order size exceeds the maximum shares per order",
+	}
+	ErrPositionLimit = &LimitError{
+		Code:    "position_limit_exceeded",
+		Message: "position would exceed the maximum shares per outcome",
+	}
+	ErrMarketNotionalLimit = &LimitError{
+		Code:    "market_notional_limit_exceeded",
+		Message: "exposure would exceed the maximum notional per market",
+	}
+)
+
+// positionLimits 市场生效的持仓限制，0 表示不限制
+type positionLimits struct {
+	MaxOrderShares    float64
+	MaxPositionShares float64
+	MaxMarketNotional float64
+}
+
+// loadPositionLimits 读取市场的持仓限制，市场未设置的项使用全局默认值
+func loadPositionLimits(db *gorm.DB, market *model.Market) (positionLimits, error) {
+	limits := positionLimits{
+		MaxOrderShares:    market.MaxOrderShares,
+		MaxPositionShares: market.MaxPositionShares,
+		MaxMarketNotional: market.MaxMarketNotional,
+	}
+
+	defaults := []struct {
+		key   string
+		value *float64
+	}{
+		{configLimitMaxOrderShares, &limits.MaxOrderShares},
+		{configLimitMaxPositionShares, &limits.MaxPositionShares},
+		{configLimitMaxMarketNotional, &limits.MaxMarketNotional},
+	}
+	for _, d := range defaults {
+		if *d.value > 0 {
+			continue
+		}
+		v, err := configFloat(db, d.key, 0)
+		if err != nil {
+			return limits, err
+		}
+		*d.value = v
+	}
+	return limits, nil
+}
+
+// checkOrderSize 检查单笔订单份额
+func (l positionLimits) checkOrderSize(shares float64) error {
+	if l.MaxOrderShares > 0 && shares > l.MaxOrderShares+shareEpsilon {
+		return fmt.Errorf("%w (max %.4f)", ErrOrderSizeLimit, l.MaxOrderShares)
+	}
+	return nil
+}
+
+// checkExposure 在事务内检查用户在市场的持仓（含未成交买单）是否超限，
+// outcomeIDs 为本次增加持仓的结果选项。需在持仓与订单写入后调用。
+func (l positionLimits) checkExposure(tx *gorm.DB, userID, marketID uint, outcomeIDs []uint) error {
+	if l.MaxPositionShares > 0 {
+		for _, outcomeID := range outcomeIDs {
+			var held, pending float64
+			if err := tx.Model(&model.Position{}).
+				Select("COALESCE(SUM(shares), 0)").
+				Where("user_id = ? AND outcome_id = ?", userID, outcomeID).
+				Scan(&held).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&model.Order{}).
+				Select("COALESCE(SUM(shares - filled_shares), 0)").
+				Where("user_id = ? AND outcome_id = ? AND order_type = ? AND status IN ?",
+					userID, outcomeID, "buy", []string{"pending", "partially_filled"}).
+				Scan(&pending).Error; err != nil {
+				return err
+			}
+			if held+pending > l.MaxPositionShares+shareEpsilon {
+				return fmt.Errorf("%w (max %.4f)", ErrPositionLimit, l.MaxPositionShares)
+			}
+		}
+	}
+
+	if l.MaxMarketNotional > 0 {
+		var held, pending float64
+		if err := tx.Model(&model.Position{}).
+			Select("COALESCE(SUM(shares * avg_price), 0)").
+			Where("user_id = ? AND market_id = ?", userID, marketID).
+			Scan(&held).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Order{}).
+			Select("COALESCE(SUM((shares - filled_shares) * price), 0)").
+			Where("user_id = ? AND market_id = ? AND order_type = ? AND status IN ?",
+				userID, marketID, "buy", []string{"pending", "partially_filled"}).
+			Scan(&pending).Error; err != nil {
+			return err
+		}
+		if held+pending > l.MaxMarketNotional+shareEpsilon {
+			return fmt.Errorf("%w (max %.2f)", ErrMarketNotionalLimit, l.MaxMarketNotional)
+		}
+	}
+	return nil
+}
+
+// validateLimitConfig 校验持仓限制配置值，其他配置键直接通过
+func validateLimitConfig(key, value string) error {
+	switch key {
+	case configLimitMaxOrderShares, configLimitMaxPositionShares, configLimitMaxMarketNotional:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		if v < 0 {
+			return errors.New("limit must not be negative")
+		}
+	}
+	return nil
+}
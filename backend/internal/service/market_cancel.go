@@ -0,0 +1,193 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 市场取消时的退款价格依据
+const (
+	RefundCostBasis = "cost_basis" // 按持仓成本价（Position.AvgPrice）退款
+	RefundLastPrice = "last_price" // 按取消时各结果选项的最新成交价退款
+)
+
+// MarketRefund 市场取消与退款的结果
+type MarketRefund struct {
+	MarketID          uint    `json:"market_id"`
+	Basis             string  `json:"basis"`
+	CancelledOrders   int     `json:"cancelled_orders"`
+	RefundedPositions int     `json:"refunded_positions"`
+	TotalRefunded     float64 `json:"total_refunded"`
+}
+
+// CancelMarket 取消市场：撤销所有挂单与条件单，按 basis 将每个持仓退款并清空，
+// 市场状态变更为 cancelled，全部在同一事务内完成
+func (s *TradingService) CancelMarket(marketID, adminID uint, basis string) (*MarketRefund, error) {
+	return s.cancelMarket(marketID, adminID, basis, "admin_cancel")
+}
+
+// cancelMarket 取消市场并退款，reason 记录在状态历史中
+func (s *TradingService) cancelMarket(marketID, adminID uint, basis, reason string) (*MarketRefund, error) {
+	unlock := s.engine.lockMarket(marketID)
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	refund, err := s.cancelMarketTx(tx, marketID, adminID, basis, reason)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// cancelMarketTx 在事务内取消市场并退款，调用方需持有市场锁
+func (s *TradingService) cancelMarketTx(tx *gorm.DB, marketID, adminID uint, basis, reason string) (*MarketRefund, error) {
+	if basis == "" {
+		basis = RefundCostBasis
+	}
+	if basis != RefundCostBasis && basis != RefundLastPrice {
+		return nil, errors.New("invalid refund basis")
+	}
+
+	var market model.Market
+	if err := tx.First(&market, marketID).Error; err != nil {
+		return nil, err
+	}
+	if err := checkMarketTransition(market.Status, "cancelled"); err != nil {
+		return nil, err
+	}
+
+	// 先锁定结果选项，与下单串行
+	mm, err := loadMarketMaker(tx, &market)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelled, err := transitionMarket(tx, marketID, market.Status, "cancelled", &adminID, reason, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !cancelled {
+		return nil, ErrMarketStatusChanged
+	}
+
+	// 待结算的提议随市场取消撤回，争议视为成立
+	var resolutions []model.MarketResolution
+	if err := tx.Where("market_id = ? AND status = ?", marketID, "proposed").Find(&resolutions).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range resolutions {
+		resolutions[i].Status = "withdrawn"
+		resolutions[i].ReversedBy = &adminID
+		resolutions[i].ReversedAt = &now
+		resolutions[i].ReverseReason = "market cancelled"
+		if err := tx.Save(&resolutions[i]).Error; err != nil {
+			return nil, err
+		}
+		if err := reviewDisputes(tx, resolutions[i].ID, "upheld", &adminID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	// 先撤单释放冻结，再按持仓退款
+	orders, err := s.cancelOpenOrdersTx(tx, marketID, nil, "market_cancelled")
+	if err != nil {
+		return nil, err
+	}
+	if err := cancelConditionalOrders(tx, "market_cancelled", "market_id = ?", marketID); err != nil {
+		return nil, err
+	}
+
+	prices := make(map[uint]float64, len(mm.outcomes))
+	if basis == RefundLastPrice {
+		if prices, err = lastTradePrices(tx, mm.outcomes); err != nil {
+			return nil, err
+		}
+	}
+
+	var positions []model.Position
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("market_id = ? AND shares > ?", marketID, shareEpsilon).
+		Order("id ASC").
+		Find(&positions).Error; err != nil {
+		return nil, err
+	}
+
+	refund := &MarketRefund{
+		MarketID:        marketID,
+		Basis:           basis,
+		CancelledOrders: len(orders),
+	}
+	for i := range positions {
+		position := &positions[i]
+		price := position.AvgPrice
+		if basis == RefundLastPrice {
+			price = prices[position.OutcomeID]
+		}
+		amount := position.Shares * price
+
+		balance, err := s.adjustBalance(tx, position.UserID, amount)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Create(&model.Transaction{
+			UserID:       position.UserID,
+			Type:         "market_refund",
+			Amount:       amount,
+			BalanceAfter: balance,
+			MarketID:     &marketID,
+			Description:  fmt.Sprintf("Market cancelled - refund %.4f shares at %.4f", position.Shares, price),
+		}).Error; err != nil {
+			return nil, err
+		}
+
+		if err := tx.Model(position).Updates(map[string]interface{}{
+			"shares":        0,
+			"locked_shares": 0,
+		}).Error; err != nil {
+			return nil, err
+		}
+
+		refund.RefundedPositions++
+		refund.TotalRefunded += amount
+	}
+
+	return refund, nil
+}
+
+// lastTradePrices 各结果选项最近一笔成交的价格，没有成交时使用当前价格
+func lastTradePrices(tx *gorm.DB, outcomes []model.Outcome) (map[uint]float64, error) {
+	prices := make(map[uint]float64, len(outcomes))
+	for _, outcome := range outcomes {
+		var trade model.Trade
+		err := tx.Where("outcome_id = ?", outcome.ID).Order("id DESC").First(&trade).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			prices[outcome.ID] = outcome.CurrentPrice
+		case err != nil:
+			return nil, err
+		default:
+			prices[outcome.ID] = trade.Price
+		}
+	}
+	return prices, nil
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 互斥组内二元市场的结果选项
+const (
+	OutcomeYes = "YES"
+	OutcomeNo  = "NO"
+)
+
+// ErrGroupResolvedYes 互斥组内已有市场结算（或提议结算）为 YES
+var ErrGroupResolvedYes = errors.New("another market in this mutually exclusive event already resolves YES")
+
+// ErrGroupNeedsYes 互斥组内其他市场都已结算（或提议结算）为 NO 或已取消，本市场只能结算为 YES
+var ErrGroupNeedsYes = errors.New("every other market in this mutually exclusive event resolves NO; this market must resolve YES")
+
+// ErrGroupTraded 互斥组已有成交或负风险转换，不能再加入市场
+var ErrGroupTraded = errors.New("markets cannot join a mutually exclusive event after its markets have traded or converted")
+
+// ErrGroupLeave 互斥组内的市场不能移出
+var ErrGroupLeave = errors.New("markets cannot leave a mutually exclusive event")
+
+// ErrGroupMember 市场不满足加入互斥组的条件
+var ErrGroupMember = errors.New("markets in a mutually exclusive event must be binary YES/NO markets")
+
+// ErrEventNotFound 赛事不存在
+var ErrEventNotFound = errors.New("event not found")
+
+// loadEvent 读取赛事
+func loadEvent(db *gorm.DB, eventID uint) (*model.Event, error) {
+	var event model.Event
+	err := db.First(&event, eventID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// lockGroupJoin 在事务内锁定赛事行，并按市场 ID 升序锁定组内所有市场及加入的市场 marketID（新建时为 0）的结果选项，
+// 使加入互斥组的校验与组内的成交、转换及其他市场的加入串行
+func lockGroupJoin(tx *gorm.DB, eventID, marketID uint) error {
+	if _, err := loadEvent(tx.Clauses(clause.Locking{Strength: "UPDATE"}), eventID); err != nil {
+		return err
+	}
+
+	var marketIDs []uint
+	if err := tx.Model(&model.Market{}).Where("event_id = ?", eventID).Pluck("id", &marketIDs).Error; err != nil {
+		return err
+	}
+	if marketID != 0 {
+		marketIDs = append(marketIDs, marketID)
+	}
+	sort.Slice(marketIDs, func(i, j int) bool { return marketIDs[i] < marketIDs[j] })
+	for _, id := range marketIDs {
+		if err := lockMarketRows(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkGroupMember 校验市场能否加入互斥组：须为结果选项为 YES 和 NO 的二元市场
+// （包括市场类型出现前创建的两个结果选项的 categorical 市场）
+func checkGroupMember(market *model.Market, outcomes []string) error {
+	if market.MarketType == MarketTypeScalar || len(outcomes) != 2 {
+		return ErrGroupMember
+	}
+	hasYes := strings.EqualFold(outcomes[0], OutcomeYes) || strings.EqualFold(outcomes[1], OutcomeYes)
+	hasNo := strings.EqualFold(outcomes[0], OutcomeNo) || strings.EqualFold(outcomes[1], OutcomeNo)
+	if !hasYes || !hasNo {
+		return fmt.Errorf("%w: the outcomes must be YES and NO", ErrGroupMember)
+	}
+	return nil
+}
+
+// checkGroupUntraded 校验互斥组尚无成交和负风险转换。组内市场的集合决定了 NO 与其他市场 YES 的等价关系，
+// 有持仓后再加入市场会让此前按旧集合转换或定价的持仓失去等价。调用方需已通过 lockGroupJoin 加锁。
+func checkGroupUntraded(db *gorm.DB, eventID uint) error {
+	marketIDs := db.Model(&model.Market{}).Select("id").Where("event_id = ?", eventID)
+
+	var trades int64
+	if err := db.Model(&model.Trade{}).Where("market_id IN (?)", marketIDs).Count(&trades).Error; err != nil {
+		return err
+	}
+	var conversions int64
+	if err := db.Model(&model.Transaction{}).
+		Where("type = ? AND market_id IN (?)", "neg_risk_convert", marketIDs).
+		Count(&conversions).Error; err != nil {
+		return err
+	}
+	if trades > 0 || conversions > 0 {
+		return ErrGroupTraded
+	}
+	return nil
+}
+
+// outcomeNames 结果选项名称列表
+func outcomeNames(outcomes []model.Outcome) []string {
+	names := make([]string, 0, len(outcomes))
+	for _, outcome := range outcomes {
+		names = append(names, outcome.OutcomeName)
+	}
+	return names
+}
+
+// outcomeNamed 按名称（不区分大小写）查找结果选项 ID
+func outcomeNamed(outcomes []model.Outcome, name string) (uint, bool) {
+	for _, outcome := range outcomes {
+		if strings.EqualFold(outcome.OutcomeName, name) {
+			return outcome.ID, true
+		}
+	}
+	return 0, false
+}
+
+// groupMarketIDs 返回市场所在互斥组内所有市场的 ID（升序，包含市场自身），市场不属于互斥组时返回 nil
+func groupMarketIDs(db *gorm.DB, market *model.Market) ([]uint, error) {
+	if market.EventID == nil {
+		return nil, nil
+	}
+	event, err := loadEvent(db, *market.EventID)
+	if err != nil {
+		return nil, err
+	}
+	if !event.MutuallyExclusive {
+		return nil, nil
+	}
+
+	var marketIDs []uint
+	err = db.Model(&model.Market{}).
+		Where("event_id = ?", event.ID).
+		Order("id ASC").
+		Pluck("id", &marketIDs).Error
+	return marketIDs, err
+}
+
+// lockMarkets 按 ID 升序锁定多个市场，避免与其他多市场操作死锁，返回解锁函数
+func (e *matchingEngine) lockMarkets(marketIDs []uint) func() {
+	ids := append([]uint(nil), marketIDs...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	unlocks := make([]func(), 0, len(ids))
+	for _, marketID := range ids {
+		unlocks = append(unlocks, e.lockMarket(marketID))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// lockResolutionScope 锁定结算可能涉及的市场：互斥组内的所有市场，不属于互斥组时仅锁定市场自身
+func (s *MarketService) lockResolutionScope(market *model.Market) (func(), error) {
+	group, err := groupMarketIDs(s.db, market)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return s.trading.engine.lockMarket(market.ID), nil
+	}
+	return s.trading.engine.lockMarkets(group), nil
+}
+
+// lockResolutionRows 在事务内按 ID 升序锁定结算可能涉及的市场的结果选项行（范围同 lockResolutionScope），
+// 使组内结算的校验与多实例下的其他结算串行
+func lockResolutionRows(tx *gorm.DB, market *model.Market) error {
+	group, err := groupMarketIDs(tx, market)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		group = []uint{market.ID}
+	}
+	for _, marketID := range group {
+		if err := lockMarketRows(tx, marketID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkGroupResolution 校验互斥组内市场的支付向量，保证组内恰好一个市场结算为 YES：只能整体结算为 YES 或 NO；
+// 组内已有其他市场提议或完成 YES 结算时不能再结算为 YES；其他市场都已不可能结算为 YES 时不能结算为 NO
+func checkGroupResolution(tx *gorm.DB, market *model.Market, payouts map[uint]float64) error {
+	group, err := groupMarketIDs(tx, market)
+	if err != nil || group == nil {
+		return err
+	}
+
+	yesID, _ := outcomeNamed(market.Outcomes, OutcomeYes)
+	noID, _ := outcomeNamed(market.Outcomes, OutcomeNo)
+	if payouts[noID] >= 1-payoutEpsilon {
+		return checkGroupYesPossible(tx, market, group)
+	}
+	if payouts[yesID] < 1-payoutEpsilon {
+		return errors.New("markets in a mutually exclusive event resolve fully YES or NO")
+	}
+
+	var yesIDs []uint
+	if err := tx.Model(&model.Outcome{}).
+		Where("market_id IN ? AND market_id <> ? AND UPPER(outcome_name) = ?", group, market.ID, OutcomeYes).
+		Pluck("id", &yesIDs).Error; err != nil {
+		return err
+	}
+	if len(yesIDs) == 0 {
+		return nil
+	}
+
+	var resolved int64
+	if err := tx.Model(&model.MarketResolution{}).
+		Where("outcome_id IN ? AND status IN ?", yesIDs, []string{"proposed", "finalized"}).
+		Count(&resolved).Error; err != nil {
+		return err
+	}
+	if resolved > 0 {
+		return ErrGroupResolvedYes
+	}
+	return nil
+}
+
+// checkGroupYesPossible 校验组内除 market 外仍有市场可能结算为 YES：尚未提议结算（待开放、交易中或已关闭），
+// 或已提议或完成 YES 结算。已提议或完成 NO 结算以及已取消的市场不再可能结算为 YES。
+func checkGroupYesPossible(tx *gorm.DB, market *model.Market, group []uint) error {
+	var open int64
+	if err := tx.Model(&model.Market{}).
+		Where("id IN ? AND id <> ? AND status IN ?", group, market.ID, []string{"pending", "active", "halted", "closed"}).
+		Count(&open).Error; err != nil {
+		return err
+	}
+	if open > 0 {
+		return nil
+	}
+
+	var yes int64
+	if err := tx.Model(&model.MarketResolution{}).
+		Joins("JOIN outcomes ON outcomes.id = market_resolutions.outcome_id").
+		Where("market_resolutions.market_id IN ? AND market_resolutions.market_id <> ?", group, market.ID).
+		Where("market_resolutions.status IN ? AND UPPER(outcomes.outcome_name) = ?", []string{"proposed", "finalized"}, OutcomeYes).
+		Count(&yes).Error; err != nil {
+		return err
+	}
+	if yes == 0 {
+		return ErrGroupNeedsYes
+	}
+	return nil
+}
+
+// resolveGroupSiblings 互斥组内的市场结算为 YES 后，在同一事务内将组内其他交易中、已关闭或待结算的市场
+// 立即结算为 NO（不设争议期），并记录对应的 parent 结算提议。
+func (s *MarketService) resolveGroupSiblings(tx *gorm.DB, parent *model.MarketResolution, payouts map[uint]float64, finalizedBy *uint) error {
+	var market model.Market
+	if err := tx.Preload("Outcomes").First(&market, parent.MarketID).Error; err != nil {
+		return err
+	}
+	group, err := groupMarketIDs(tx, &market)
+	if err != nil || group == nil {
+		return err
+	}
+	yesID, _ := outcomeNamed(market.Outcomes, OutcomeYes)
+	if payouts[yesID] < 1-payoutEpsilon {
+		return nil
+	}
+
+	proposedBy := parent.ProposedBy
+	if finalizedBy != nil {
+		proposedBy = *finalizedBy
+	}
+
+	for _, marketID := range group {
+		if marketID == market.ID {
+			continue
+		}
+		if err := lockMarketRows(tx, marketID); err != nil {
+			return err
+		}
+		var sibling model.Market
+		if err := tx.Preload("Outcomes").First(&sibling, marketID).Error; err != nil {
+			return err
+		}
+
+		var resolution *model.MarketResolution
+		switch sibling.Status {
+		case "pending":
+			// 待开放的市场结果也已确定，先开放再结算为 NO，避免之后被生命周期调度开放交易
+			opened, err := transitionMarket(tx, marketID, "pending", "active", finalizedBy, "group_resolved", nil)
+			if err != nil {
+				return err
+			}
+			if !opened {
+				return ErrMarketStatusChanged
+			}
+			noID, _ := outcomeNamed(sibling.Outcomes, OutcomeNo)
+			resolution, err = s.proposeResolution(tx, marketID, "active", map[uint]float64{noID: 1}, nil, proposedBy)
+		case "active", "halted", "closed":
+			noID, _ := outcomeNamed(sibling.Outcomes, OutcomeNo)
+			resolution, err = s.proposeResolution(tx, marketID, sibling.Status, map[uint]float64{noID: 1}, nil, proposedBy)
+		case "proposed":
+			// 已有的提议只能是 NO（见 checkGroupResolution）
+			resolution, err = lockResolution(tx, marketID, "proposed")
+		default:
+			// 已结算或已取消的市场不变
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		resolution.ParentResolutionID = &parent.ID
+		if err := tx.Model(resolution).Update("parent_resolution_id", parent.ID).Error; err != nil {
+			return err
+		}
+		if resolution.Status == "proposed" {
+			if err := s.finalizeResolution(tx, resolution, finalizedBy); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reverseGroupSiblings 撤销因 parent 结算为 YES 而自动结算为 NO 的市场，这些市场回到 closed 状态
+func (s *MarketService) reverseGroupSiblings(tx *gorm.DB, parent *model.MarketResolution, adminID uint, reason string, now time.Time) error {
+	var resolutions []model.MarketResolution
+	if err := tx.Where("parent_resolution_id = ? AND status = ?", parent.ID, "finalized").
+		Order("market_id ASC").
+		Find(&resolutions).Error; err != nil {
+		return err
+	}
+
+	for i := range resolutions {
+		resolution := &resolutions[i]
+		if err := lockMarketRows(tx, resolution.MarketID); err != nil {
+			return err
+		}
+		changed, err := s.reverseFinalized(tx, resolution, adminID)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return fmt.Errorf("market %d: %w", resolution.MarketID, ErrMarketStatusChanged)
+		}
+
+		resolution.ReversedBy = &adminID
+		resolution.ReversedAt = &now
+		resolution.ReverseReason = reason
+		if err := tx.Save(resolution).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
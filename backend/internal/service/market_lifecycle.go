@@ -0,0 +1,150 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// RunLifecycleScheduler 定期按市场的开始、结束和结算时间推进市场状态，并结算争议期已结束的提议。
+// 状态变更均为带原状态条件的更新（见 transitionMarket），多个实例同时运行时每个变更只会生效一次。
+func (s *MarketService) RunLifecycleScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runLifecycle(time.Now())
+	}
+}
+
+// runLifecycle 执行一轮市场生命周期调度
+func (s *MarketService) runLifecycle(now time.Time) {
+	marketIDs, err := s.marketRepo.FindMarketsDueToOpen(now)
+	if err != nil {
+		log.Printf("Failed to find markets due to open: %v", err)
+	}
+	for _, marketID := range marketIDs {
+		if err := s.openMarket(marketID); err != nil {
+			log.Printf("Failed to open market %d: %v", marketID, err)
+		}
+	}
+
+	marketIDs, err = s.marketRepo.FindMarketsDueToClose(now)
+	if err != nil {
+		log.Printf("Failed to find markets due to close: %v", err)
+	}
+	for _, marketID := range marketIDs {
+		closed, err := s.closeMarket(marketID, nil, "end_time")
+		if err != nil {
+			log.Printf("Failed to close market %d: %v", marketID, err)
+		} else if closed {
+			log.Printf("Market %d closed at its end time", marketID)
+		}
+	}
+
+	s.finalizeDueResolutions(now)
+
+	markets, err := s.marketRepo.FindMarketsOverdueForResolution(now)
+	if err != nil {
+		log.Printf("Failed to find markets overdue for resolution: %v", err)
+	}
+	for _, market := range markets {
+		if err := s.alertOverdueResolution(&market, now); err != nil {
+			log.Printf("Failed to flag market %d overdue for resolution: %v", market.ID, err)
+		}
+	}
+}
+
+// openMarket 到达开始时间的待开放市场开始交易
+func (s *MarketService) openMarket(marketID uint) error {
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	opened, err := transitionMarket(tx, marketID, "pending", "active", nil, "start_time", nil)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	if opened {
+		log.Printf("Market %d opened at its start time", marketID)
+	}
+	return nil
+}
+
+// closeMarket 交易中（active / halted）的市场停止交易并撤销所有挂单，市场不在交易中时返回 false。
+// changedBy 为空表示系统在结束时间自动关闭。
+func (s *MarketService) closeMarket(marketID uint, changedBy *uint, reason string) (bool, error) {
+	unlock := s.trading.engine.lockMarket(marketID)
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	closed, err := s.closeMarketTx(tx, marketID, changedBy, reason)
+	if err != nil || !closed {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit().Error
+}
+
+// closeMarketTx 在事务内关闭交易中的市场，并撤销其挂单与条件单，市场不在交易中时返回 false。
+// 调用方需持有市场锁。
+func (s *MarketService) closeMarketTx(tx *gorm.DB, marketID uint, changedBy *uint, reason string) (bool, error) {
+	// 先锁定结果选项，与下单串行，避免关闭后仍有订单挂入
+	if err := lockMarketRows(tx, marketID); err != nil {
+		return false, err
+	}
+
+	var market model.Market
+	if err := tx.Select("id", "status").First(&market, marketID).Error; err != nil {
+		return false, err
+	}
+	if market.Status != "active" && market.Status != "halted" {
+		// 其他实例已处理或状态已被修改
+		return false, nil
+	}
+
+	closed, err := transitionMarket(tx, marketID, market.Status, "closed", changedBy, reason, nil)
+	if err != nil || !closed {
+		return false, err
+	}
+
+	if _, err := s.trading.cancelOpenOrdersTx(tx, marketID, nil, "market_closed"); err != nil {
+		return false, err
+	}
+	if err := cancelConditionalOrders(tx, "market_closed", "market_id = ?", marketID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// alertOverdueResolution 已关闭市场超过结算时间仍未结算时发出告警，每个市场只告警一次
+func (s *MarketService) alertOverdueResolution(market *model.Market, now time.Time) error {
+	result := s.db.Model(&model.Market{}).
+		Where("id = ? AND status = ? AND resolution_overdue_at IS NULL", market.ID, "closed").
+		Update("resolution_overdue_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("ALERT: market %d (%q) passed its resolution time %s and is still unresolved",
+			market.ID, market.Title, market.ResolutionTime.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"math"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultLiquidityParam 默认 LMSR 流动性参数 b
+const defaultLiquidityParam = 100.0
+
+// logSumExp 计算 ln(Σ exp(q_i / b))，避免指数溢出
+func logSumExp(q []float64, b float64, skip int) float64 {
+	maxV := math.Inf(-1)
+	for i, v := range q {
+		if i != skip && v/b > maxV {
+			maxV = v / b
+		}
+	}
+	if math.IsInf(maxV, -1) {
+		return maxV
+	}
+
+	sum := 0.0
+	for i, v := range q {
+		if i != skip {
+			sum += math.Exp(v/b - maxV)
+		}
+	}
+	return maxV + math.Log(sum)
+}
+
+// lmsrCost LMSR 成本函数 C(q) = b * ln(Σ exp(q_i / b))
+func lmsrCost(q []float64, b float64) float64 {
+	return b * logSumExp(q, b, -1)
+}
+
+// lmsrPrices 各结果的边际价格 p_i = exp(q_i / b) / Σ exp(q_j / b)，总和为 1
+func lmsrPrices(q []float64, b float64) []float64 {
+	lse := logSumExp(q, b, -1)
+	prices := make([]float64, len(q))
+	for i, v := range q {
+		prices[i] = math.Exp(v/b - lse)
+	}
+	return prices
+}
+
+// lmsrTradeCost 结果 i 的份额变动 delta 的成本（delta < 0 为卖出，返回负数即卖出所得）
+func lmsrTradeCost(q []float64, b float64, i int, delta float64) float64 {
+	after := make([]float64, len(q))
+	copy(after, q)
+	after[i] += delta
+	return lmsrCost(after, b) - lmsrCost(q, b)
+}
+
+// lmsrSharesToPrice 使结果 i 的价格变为 p 所需的份额变动
+func lmsrSharesToPrice(q []float64, b float64, i int, p float64) float64 {
+	if p >= 1 {
+		return math.Inf(1)
+	}
+	if p <= 0 {
+		return math.Inf(-1)
+	}
+	return b*(math.Log(p)-math.Log(1-p)+logSumExp(q, b, i)) - q[i]
+}
+
+// lmsrSharesForCost 花费 cost 可买入结果 i 的份额
+func lmsrSharesForCost(q []float64, b float64, i int, cost float64) float64 {
+	// C(q + d·e_i) - C(q) = cost  =>  d = b·ln(exp(L + cost/b) - exp(L_i)) - q_i
+	// 其中 L = ln Σ exp(q_j/b)，L_i 为去掉结果 i 后的同一求和
+	a := logSumExp(q, b, -1) + cost/b
+	other := logSumExp(q, b, i)
+	return b*(a+math.Log1p(-math.Exp(other-a))) - q[i]
+}
+
+// marketMaker 单个市场的 LMSR 做市商状态
+type marketMaker struct {
+	b        float64
+	outcomes []model.Outcome
+	q        []float64
+	index    map[uint]int
+	dirty    bool
+}
+
+// loadMarketMaker 在事务内锁定并加载市场的所有结果选项
+func loadMarketMaker(tx *gorm.DB, market *model.Market) (*marketMaker, error) {
+	var outcomes []model.Outcome
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("market_id = ?", market.ID).
+		Order("id ASC").
+		Find(&outcomes).Error; err != nil {
+		return nil, err
+	}
+	return newMarketMaker(market, outcomes), nil
+}
+
+// newMarketMaker 根据市场与结果选项构建做市商状态
+func newMarketMaker(market *model.Market, outcomes []model.Outcome) *marketMaker {
+	b := market.LiquidityParam
+	if b <= 0 {
+		b = defaultLiquidityParam
+	}
+
+	mm := &marketMaker{
+		b:        b,
+		outcomes: outcomes,
+		q:        make([]float64, len(outcomes)),
+		index:    make(map[uint]int, len(outcomes)),
+	}
+	for i, outcome := range outcomes {
+		mm.q[i] = outcome.AMMShares
+		mm.index[outcome.ID] = i
+	}
+	return mm
+}
+
+// clone 复制做市商状态，用于不影响实际成交的预估
+func (m *marketMaker) clone() *marketMaker {
+	return &marketMaker{
+		b:        m.b,
+		outcomes: append([]model.Outcome(nil), m.outcomes...),
+		q:        append([]float64(nil), m.q...),
+		index:    m.index,
+		dirty:    m.dirty,
+	}
+}
+
+// price 结果选项的当前边际价格
+func (m *marketMaker) price(outcomeID uint) float64 {
+	return lmsrPrices(m.q, m.b)[m.index[outcomeID]]
+}
+
+// prices 所有结果选项的当前价格
+func (m *marketMaker) prices() map[uint]float64 {
+	result := make(map[uint]float64, len(m.outcomes))
+	for i, p := range lmsrPrices(m.q, m.b) {
+		result[m.outcomes[i].ID] = p
+	}
+	return result
+}
+
+// sharesToPrice 使结果选项价格达到 p 所需的份额变动（正数为买入，负数为卖出）
+func (m *marketMaker) sharesToPrice(outcomeID uint, p float64) float64 {
+	return lmsrSharesToPrice(m.q, m.b, m.index[outcomeID], p)
+}
+
+// sharesForCost 花费 cost 可从做市商买入的份额
+func (m *marketMaker) sharesForCost(outcomeID uint, cost float64) float64 {
+	return lmsrSharesForCost(m.q, m.b, m.index[outcomeID], cost)
+}
+
+// tradeCost 份额变动 delta 的成本（卖出时为负数），不改变做市商状态
+func (m *marketMaker) tradeCost(outcomeID uint, delta float64) float64 {
+	return lmsrTradeCost(m.q, m.b, m.index[outcomeID], delta)
+}
+
+// execute 执行份额变动并返回成本（卖出时为负数）
+func (m *marketMaker) execute(outcomeID uint, delta float64) float64 {
+	i := m.index[outcomeID]
+	cost := lmsrTradeCost(m.q, m.b, i, delta)
+	m.q[i] += delta
+	m.outcomes[i].AMMShares = m.q[i]
+	m.outcomes[i].TotalShares += delta
+	m.dirty = true
+	return cost
+}
+
+// save 将做市商状态和最新价格写回数据库
+func (m *marketMaker) save(tx *gorm.DB) error {
+	if !m.dirty {
+		return nil
+	}
+
+	prices := lmsrPrices(m.q, m.b)
+	for i := range m.outcomes {
+		m.outcomes[i].CurrentPrice = prices[i]
+		if err := tx.Model(&model.Outcome{}).
+			Where("id = ?", m.outcomes[i].ID).
+			Updates(map[string]interface{}{
+				"amm_shares":    m.outcomes[i].AMMShares,
+				"total_shares":  m.outcomes[i].TotalShares,
+				"current_price": prices[i],
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+)
+
+const mathTolerance = 1e-9
+
+func TestLMSRCostAtZeroIsBLogN(t *testing.T) {
+	for _, n := range []int{2, 3, 5} {
+		q := make([]float64, n)
+		if got, want := lmsrCost(q, 100), 100*math.Log(float64(n)); math.Abs(got-want) > mathTolerance {
+			t.Errorf("n=%d: cost %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestLMSRPricesSumToOne(t *testing.T) {
+	for _, q := range [][]float64{
+		{0, 0},
+		{250, -40},
+		{10, 20, 30},
+		{5000, 0, -5000}, // 远超 b 的份额也不应溢出
+	} {
+		sum := 0.0
+		for _, p := range lmsrPrices(q, 100) {
+			if p < 0 || p > 1 {
+				t.Errorf("q=%v: price %v out of range", q, p)
+			}
+			sum += p
+		}
+		if math.Abs(sum-1) > mathTolerance {
+			t.Errorf("q=%v: prices sum to %v", q, sum)
+		}
+	}
+}
+
+func TestLMSRPriceIsCostDerivative(t *testing.T) {
+	q := []float64{30, -10, 5}
+	const h = 1e-6
+	for i, p := range lmsrPrices(q, 100) {
+		slope := (lmsrTradeCost(q, 100, i, h) - lmsrTradeCost(q, 100, i, -h)) / (2 * h)
+		if math.Abs(slope-p) > 1e-6 {
+			t.Errorf("outcome %d: slope %v, price %v", i, slope, p)
+		}
+	}
+}
+
+func TestLMSRSharesForCostInvertsTradeCost(t *testing.T) {
+	q := []float64{40, 0, -25}
+	for _, cost := range []float64{0.01, 1, 37.5, 500} {
+		shares := lmsrSharesForCost(q, 100, 1, cost)
+		if got := lmsrTradeCost(q, 100, 1, shares); math.Abs(got-cost) > 1e-6 {
+			t.Errorf("cost %v: %v shares cost %v", cost, shares, got)
+		}
+	}
+}
+
+func TestLMSRSharesToPriceReachesPrice(t *testing.T) {
+	q := []float64{0, 0}
+	for _, p := range []float64{0.1, 0.5, 0.73, 0.99} {
+		after := append([]float64(nil), q...)
+		after[0] += lmsrSharesToPrice(q, 100, 0, p)
+		if got := lmsrPrices(after, 100)[0]; math.Abs(got-p) > mathTolerance {
+			t.Errorf("target %v: price %v", p, got)
+		}
+	}
+}
+
+func TestLMSRLossIsBounded(t *testing.T) {
+	// 做市商的最大亏损为 b·ln(n)：无论怎样成交，收入 C(q)-C(0) 与任一结果胜出时的赔付之差不低于 -b·ln(n)
+	const b = 100.0
+	q := make([]float64, 3)
+	start := lmsrCost(q, b)
+	for _, trade := range []struct {
+		i     int
+		delta float64
+	}{{0, 500}, {1, 2000}, {0, -300}, {2, 10000}, {1, -1500}} {
+		q[trade.i] += trade.delta
+	}
+	revenue := lmsrCost(q, b) - start
+	for i, payout := range q {
+		if loss := payout - revenue; loss > b*math.Log(3)+mathTolerance {
+			t.Errorf("outcome %d wins: loss %v exceeds bound %v", i, loss, b*math.Log(3))
+		}
+	}
+}
+
+func newTestMarketMaker() *marketMaker {
+	return newMarketMaker(&model.Market{LiquidityParam: 100}, []model.Outcome{{ID: 1}, {ID: 2}})
+}
+
+func TestRouteOrderRoundsMarketMakerCash(t *testing.T) {
+	noBook := func(bookOrder, float64) (float64, float64, error) { return 0, 0, nil }
+
+	for _, side := range []string{"buy", "sell"} {
+		mm := newTestMarketMaker()
+		limit := 0.99
+		if side == "sell" {
+			limit = 0.01
+		}
+		exact := mm.tradeCost(1, 3.333)
+		if side == "sell" {
+			exact = -mm.tradeCost(1, -3.333)
+		}
+
+		var notional float64
+		onMarketMaker := func(shares, amount float64) error {
+			notional = amount
+			return nil
+		}
+		if _, err := routeOrder(mm, nil, 1, side, limit, 3.333, 0, noBook, onMarketMaker); err != nil {
+			t.Fatal(err)
+		}
+
+		want := ceilCents(exact)
+		if side == "sell" {
+			want = floorCents(exact)
+		}
+		if notional != want {
+			t.Errorf("%s: notional %v, want %v (exact %v)", side, notional, want, exact)
+		}
+	}
+}
+
+func TestRouteOrderRefusesSubCentMarketMakerFill(t *testing.T) {
+	mm := newTestMarketMaker()
+	called := false
+	onMarketMaker := func(shares, notional float64) error {
+		called = true
+		return nil
+	}
+	noBook := func(bookOrder, float64) (float64, float64, error) { return 0, 0, nil }
+
+	// 0.005 份额约值 0.0025，卖出所得向下取整为 0，不应成交
+	filled, err := routeOrder(mm, nil, 1, "sell", 0.01, 0.005, 0, noBook, onMarketMaker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if called || filled != 0 || mm.dirty {
+		t.Errorf("sub-cent sell filled %v shares", filled)
+	}
+}
@@ -1,7 +1,8 @@
 package service
 
 import (
-	"errors"
+	"fmt"
+	"time"
 
 	"github.com/huabtc/polygame/backend/internal/model"
 	"github.com/huabtc/polygame/backend/internal/repository"
@@ -14,6 +15,7 @@ type MarketService struct {
 	userRepo     *repository.UserRepository
 	txRepo       *repository.TransactionRepository
 	db           *gorm.DB
+	trading      *TradingService
 }
 
 func NewMarketService(
@@ -22,6 +24,7 @@ func NewMarketService(
 	userRepo *repository.UserRepository,
 	txRepo *repository.TransactionRepository,
 	db *gorm.DB,
+	trading *TradingService,
 ) *MarketService {
 	return &MarketService{
 		marketRepo:   marketRepo,
@@ -29,6 +32,7 @@ func NewMarketService(
 		userRepo:     userRepo,
 		txRepo:       txRepo,
 		db:           db,
+		trading:      trading,
 	}
 }
 
@@ -42,23 +46,55 @@ func (s *MarketService) CreateMarket(market *model.Market, outcomes []string) er
 		}
 	}()
 
+	if market.LiquidityParam <= 0 {
+		market.LiquidityParam = defaultLiquidityParam
+	}
+
+	outcomes, err := prepareMarketType(market, outcomes)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if market.EventID != nil {
+		event, err := loadEvent(tx, *market.EventID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if event.MutuallyExclusive {
+			if err := checkGroupMember(market, outcomes); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if err := lockGroupJoin(tx, event.ID, 0); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if err := checkGroupUntraded(tx, event.ID); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
 	// 创建市场
 	if err := tx.Create(market).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	// 创建结果选项
+	// 创建结果选项，LMSR 初始状态下各结果价格均等
 	for _, outcomeName := range outcomes {
 		outcome := model.Outcome{
 			MarketID:     market.ID,
 			OutcomeName:  outcomeName,
-			CurrentPrice: 0.5, // 初始价格 0.5
+			CurrentPrice: 1 / float64(len(outcomes)),
 		}
 		if err := tx.Create(&outcome).Error; err != nil {
 			tx.Rollback()
 			return err
 		}
+		market.Outcomes = append(market.Outcomes, outcome)
 	}
 
 	return tx.Commit().Error
@@ -69,37 +105,60 @@ func (s *MarketService) GetMarket(marketID uint) (*model.Market, error) {
 	return s.marketRepo.FindByID(marketID)
 }
 
+// GetMarketDetail 获取市场详情，包含最近的暂停与恢复记录
+func (s *MarketService) GetMarketDetail(marketID uint) (*model.Market, error) {
+	return s.marketRepo.FindDetailByID(marketID)
+}
+
+// HaltMarket 管理员暂停市场或单个结果选项
+func (s *MarketService) HaltMarket(marketID uint, outcomeID *uint, duration time.Duration, adminID uint) error {
+	return s.trading.HaltMarket(marketID, outcomeID, duration, adminID)
+}
+
+// ResumeMarket 管理员恢复市场交易
+func (s *MarketService) ResumeMarket(marketID, adminID uint) error {
+	return s.trading.ResumeMarket(marketID, adminID)
+}
+
+// CancelMarket 管理员取消市场并按 basis 为所有持仓退款
+func (s *MarketService) CancelMarket(marketID, adminID uint, basis string) (*MarketRefund, error) {
+	return s.trading.CancelMarket(marketID, adminID, basis)
+}
+
 // ListMarkets 获取市场列表
 func (s *MarketService) ListMarkets(category, status string, page, pageSize int) ([]model.Market, int64, error) {
 	return s.marketRepo.List(category, status, page, pageSize)
 }
 
-// UpdateMarket 更新市场（管理员）
-func (s *MarketService) UpdateMarket(market *model.Market) error {
-	return s.marketRepo.Update(market)
+// marketEditableFields 管理员可直接修改的市场字段，状态须经状态机变更
+var marketEditableFields = []string{
+	"event_id", "title", "description", "image_url",
+	"max_order_shares", "max_position_shares", "max_market_notional",
+	"breaker_price_move", "breaker_window_minutes", "breaker_cooldown_minutes", "breaker_scope",
 }
 
-// ResolveMarket 结算市场（管理员）
-func (s *MarketService) ResolveMarket(marketID, winningOutcomeID, resolvedBy uint) error {
-	// 验证市场状态
-	market, err := s.marketRepo.FindByID(marketID)
+// UpdateMarket 更新市场（管理员）。状态变更须符合状态机，并记录状态历史。
+func (s *MarketService) UpdateMarket(market *model.Market, changedBy uint) error {
+	current, err := s.marketRepo.FindByID(market.ID)
 	if err != nil {
 		return err
 	}
-	if market.Status == "resolved" {
-		return errors.New("market already resolved")
-	}
 
-	// 验证获胜结果是否存在
-	validOutcome := false
-	for _, outcome := range market.Outcomes {
-		if outcome.ID == winningOutcomeID {
-			validOutcome = true
-			break
+	statusChanged := market.Status != current.Status
+	if statusChanged {
+		if err := checkMarketTransition(current.Status, market.Status); err != nil {
+			return err
+		}
+		// 暂停、恢复、结算与取消需同时处理结果选项、暂停记录或持仓，只能通过专用接口
+		if market.Status == "halted" || current.Status == "halted" && market.Status == "active" {
+			return fmt.Errorf("%w: use the halt and resume endpoints", ErrInvalidStatusTransition)
+		}
+		if market.Status == "proposed" || current.Status == "proposed" || current.Status == "resolved" {
+			return fmt.Errorf("%w: use the resolve, finalize and unresolve endpoints", ErrInvalidStatusTransition)
+		}
+		if market.Status == "cancelled" {
+			return fmt.Errorf("%w: use the cancel endpoint", ErrInvalidStatusTransition)
 		}
-	}
-	if !validOutcome {
-		return errors.New("invalid winning outcome")
 	}
 
 	// 开始事务
@@ -110,66 +169,83 @@ func (s *MarketService) ResolveMarket(marketID, winningOutcomeID, resolvedBy uin
 		}
 	}()
 
-	// 更新市场状态
-	if err := tx.Model(&model.Market{}).
-		Where("id = ?", marketID).
-		Updates(map[string]interface{}{
-			"status":          "resolved",
-			"winning_outcome": winningOutcomeID,
-			"resolved_by":     resolvedBy,
-		}).Error; err != nil {
+	if err := checkEventChange(tx, current, market.EventID); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	// 获取所有持仓
-	positions, err := s.positionRepo.FindByMarketID(marketID)
-	if err != nil {
+	if err := tx.Model(&model.Market{ID: market.ID}).Select(marketEditableFields).Updates(market).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	// 结算持仓
-	for _, position := range positions {
-		if position.OutcomeID == winningOutcomeID {
-			// 获胜方：每份额获得 1.0 虚拟积分
-			payout := position.Shares * 1.0
+	if statusChanged {
+		changed, err := transitionMarket(tx, market.ID, current.Status, market.Status, &changedBy, "admin_update", nil)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if !changed {
+			tx.Rollback()
+			return ErrMarketStatusChanged
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
 
-			if err := tx.Model(&model.User{}).
-				Where("id = ?", position.UserID).
-				UpdateColumn("virtual_balance", gorm.Expr("virtual_balance + ?", payout)).
-				Error; err != nil {
-				tx.Rollback()
-				return err
-			}
+	// 市场离开交易状态（active / halted）时撤销所有挂单，熔断暂停保留挂单
+	tradable := func(status string) bool { return status == "active" || status == "halted" }
+	if tradable(current.Status) && !tradable(market.Status) {
+		if _, err := s.trading.CancelMarketOrders(market.ID, "market_"+market.Status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEventChange 在事务内校验市场所属赛事的变更：新赛事须存在，加入互斥组的须为 YES/NO 二元市场
+// 且组内尚无成交和负风险转换（校验前锁定赛事与组内市场，见 lockGroupJoin），互斥组内的市场不能移出
+func checkEventChange(tx *gorm.DB, current *model.Market, eventID *uint) error {
+	sameEvent := func(a, b *uint) bool { return a == nil && b == nil || a != nil && b != nil && *a == *b }
+	if sameEvent(current.EventID, eventID) {
+		return nil
+	}
 
-			// 记录交易
-			user, _ := s.userRepo.FindByID(position.UserID)
-			txRecord := &model.Transaction{
-				UserID:       position.UserID,
-				Type:         "settlement_win",
-				Amount:       payout,
-				BalanceAfter: user.VirtualBalance + payout,
-				MarketID:     &marketID,
-				Description:  "Market settlement - win",
+	if current.EventID != nil {
+		event, err := loadEvent(tx, *current.EventID)
+		if err != nil {
+			return err
+		}
+		if event.MutuallyExclusive {
+			return ErrGroupLeave
+		}
+	}
+	if eventID != nil {
+		event, err := loadEvent(tx, *eventID)
+		if err != nil {
+			return err
+		}
+		if event.MutuallyExclusive {
+			if err := checkGroupMember(current, outcomeNames(current.Outcomes)); err != nil {
+				return err
 			}
-			tx.Create(txRecord)
-		} else {
-			// 失败方：记录损失
-			user, _ := s.userRepo.FindByID(position.UserID)
-			txRecord := &model.Transaction{
-				UserID:       position.UserID,
-				Type:         "settlement_loss",
-				Amount:       0,
-				BalanceAfter: user.VirtualBalance,
-				MarketID:     &marketID,
-				Description:  "Market settlement - loss",
+			if err := lockGroupJoin(tx, event.ID, current.ID); err != nil {
+				return err
 			}
-			tx.Create(txRecord)
+			return checkGroupUntraded(tx, event.ID)
 		}
 	}
+	return nil
+}
 
-	return tx.Commit().Error
+// GetStatusHistory 获取市场的状态变更记录
+func (s *MarketService) GetStatusHistory(marketID uint) ([]model.MarketStatusHistory, error) {
+	if _, err := s.marketRepo.FindByID(marketID); err != nil {
+		return nil, err
+	}
+	return s.marketRepo.FindStatusHistory(marketID)
 }
 
 // GetTrendingMarkets 获取热门市场
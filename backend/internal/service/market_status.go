@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// marketTransitions 市场状态机：每个状态可以变更到的状态
+var marketTransitions = map[string][]string{
+	"pending":   {"active", "cancelled"},
+	"active":    {"halted", "closed", "proposed", "cancelled"},
+	"halted":    {"active", "closed", "proposed", "cancelled"},
+	"closed":    {"proposed", "cancelled"},
+	"proposed":  {"resolved", "closed", "cancelled"}, // 结算、撤回提议或取消市场
+	"resolved":  {"closed"},                          // 撤销结算
+	"cancelled": {},
+}
+
+// 市场状态错误
+var (
+	ErrInvalidMarketStatus     = errors.New("invalid market status")
+	ErrInvalidStatusTransition = errors.New("illegal market status transition")
+	ErrMarketStatusChanged     = errors.New("market status was changed concurrently")
+)
+
+// validMarketStatus 判断是否为已定义的市场状态
+func validMarketStatus(status string) bool {
+	_, ok := marketTransitions[status]
+	return ok
+}
+
+// checkMarketTransition 校验市场状态变更是否合法
+func checkMarketTransition(from, to string) error {
+	if !validMarketStatus(to) {
+		return ErrInvalidMarketStatus
+	}
+	for _, next := range marketTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, from, to)
+}
+
+// transitionMarket 在事务内将市场状态从 from 变更为 to，同时更新 changes 中的字段并记录状态历史。
+// 以原状态为条件更新，市场状态已被其他请求或实例修改时返回 false。changedBy 为空表示系统自动变更。
+func transitionMarket(tx *gorm.DB, marketID uint, from, to string, changedBy *uint, reason string, changes map[string]interface{}) (bool, error) {
+	if err := checkMarketTransition(from, to); err != nil {
+		return false, err
+	}
+
+	updates := map[string]interface{}{"status": to}
+	for column, value := range changes {
+		updates[column] = value
+	}
+	result := tx.Model(&model.Market{}).
+		Where("id = ? AND status = ?", marketID, from).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	return true, tx.Create(&model.MarketStatusHistory{
+		MarketID:   marketID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedBy:  changedBy,
+		Reason:     reason,
+	}).Error
+}
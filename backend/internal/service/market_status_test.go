@@ -0,0 +1,31 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckMarketTransition(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		err      error
+	}{
+		{"pending", "active", nil},
+		{"active", "halted", nil},
+		{"halted", "active", nil},
+		{"closed", "proposed", nil},
+		{"proposed", "resolved", nil},
+		{"proposed", "closed", nil},
+		{"resolved", "closed", nil},
+		{"pending", "resolved", ErrInvalidStatusTransition},
+		{"closed", "active", ErrInvalidStatusTransition},
+		{"resolved", "active", ErrInvalidStatusTransition},
+		{"cancelled", "active", ErrInvalidStatusTransition},
+		{"active", "archived", ErrInvalidMarketStatus},
+	} {
+		err := checkMarketTransition(tc.from, tc.to)
+		if tc.err == nil && err != nil || tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("%s -> %s: got %v, want %v", tc.from, tc.to, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"math"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+)
+
+// 市场类型
+const (
+	MarketTypeBinary      = "binary"      // 两个结果选项，其中一个获胜
+	MarketTypeCategorical = "categorical" // 多个结果选项，其中一个获胜
+	MarketTypeScalar      = "scalar"      // 区间市场：LONG/SHORT 按结算数值在上下界间的位置线性支付
+)
+
+// 区间市场的结果选项
+const (
+	ScalarOutcomeLong  = "LONG"
+	ScalarOutcomeShort = "SHORT"
+)
+
+// ResolutionInput 结算输入：区间市场提交结算数值，其他市场提交支付向量（结果选项 ID 到每份额支付比例的映射）
+type ResolutionInput struct {
+	Payouts map[uint]float64
+	Value   *float64
+}
+
+// prepareMarketType 校验创建市场时的类型与结果选项，返回需创建的结果选项名称。
+// 未指定类型时，两个结果选项为 binary，更多为 categorical。
+func prepareMarketType(market *model.Market, outcomes []string) ([]string, error) {
+	if market.MarketType == "" {
+		market.MarketType = MarketTypeCategorical
+		if len(outcomes) == 2 {
+			market.MarketType = MarketTypeBinary
+		}
+	}
+
+	switch market.MarketType {
+	case MarketTypeScalar:
+		if len(outcomes) > 0 {
+			return nil, errors.New("scalar markets have fixed LONG and SHORT outcomes")
+		}
+		if market.ScalarLower == nil || market.ScalarUpper == nil {
+			return nil, errors.New("scalar markets require scalar_lower and scalar_upper")
+		}
+		if *market.ScalarLower >= *market.ScalarUpper {
+			return nil, errors.New("scalar_lower must be less than scalar_upper")
+		}
+		return []string{ScalarOutcomeLong, ScalarOutcomeShort}, nil
+	case MarketTypeBinary, MarketTypeCategorical:
+		if market.ScalarLower != nil || market.ScalarUpper != nil {
+			return nil, errors.New("only scalar markets have scalar bounds")
+		}
+		if len(outcomes) < 2 {
+			return nil, errors.New("at least 2 outcomes are required")
+		}
+		if market.MarketType == MarketTypeBinary && len(outcomes) != 2 {
+			return nil, errors.New("binary markets have exactly 2 outcomes")
+		}
+		return outcomes, nil
+	}
+	return nil, errors.New("invalid market type")
+}
+
+// resolutionPayoutsFor 按市场类型将结算输入转换为支付向量并校验
+func resolutionPayoutsFor(market *model.Market, input ResolutionInput) (map[uint]float64, error) {
+	if market.MarketType == MarketTypeScalar {
+		if input.Value == nil || input.Payouts != nil {
+			return nil, errors.New("scalar markets are resolved with a value")
+		}
+		return scalarPayouts(market, *input.Value)
+	}
+
+	if input.Value != nil {
+		return nil, errors.New("only scalar markets are resolved with a value")
+	}
+	if err := validatePayouts(market, input.Payouts); err != nil {
+		return nil, err
+	}
+	return input.Payouts, nil
+}
+
+// scalarPayouts 区间市场按结算数值计算支付向量：LONG 每份额支付 (value - lower) / (upper - lower)，
+// 超出区间时按边界计算，SHORT 支付其余部分
+func scalarPayouts(market *model.Market, value float64) (map[uint]float64, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, errors.New("invalid resolution value")
+	}
+
+	lower, upper := *market.ScalarLower, *market.ScalarUpper
+	long := math.Min(math.Max((value-lower)/(upper-lower), 0), 1)
+
+	payouts := make(map[uint]float64, 2)
+	for _, outcome := range market.Outcomes {
+		switch outcome.OutcomeName {
+		case ScalarOutcomeLong:
+			payouts[outcome.ID] = long
+		case ScalarOutcomeShort:
+			payouts[outcome.ID] = 1 - long
+		}
+	}
+	if len(payouts) != 2 {
+		return nil, errors.New("scalar market is missing its LONG or SHORT outcome")
+	}
+	return payouts, nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+)
+
+func newScalarMarket(lower, upper float64) *model.Market {
+	return &model.Market{
+		MarketType:  MarketTypeScalar,
+		ScalarLower: &lower,
+		ScalarUpper: &upper,
+		Outcomes:    []model.Outcome{{ID: 1, OutcomeName: ScalarOutcomeLong}, {ID: 2, OutcomeName: ScalarOutcomeShort}},
+	}
+}
+
+func TestScalarPayouts(t *testing.T) {
+	market := newScalarMarket(20, 60)
+	for _, tc := range []struct {
+		value, long float64
+	}{
+		{35, 0.375},
+		{20, 0},
+		{60, 1},
+		{0, 0},   // 低于下界按下界
+		{100, 1}, // 高于上界按上界
+	} {
+		payouts, err := scalarPayouts(market, tc.value)
+		if err != nil {
+			t.Fatalf("value %v: %v", tc.value, err)
+		}
+		if math.Abs(payouts[1]-tc.long) > mathTolerance || math.Abs(payouts[2]-(1-tc.long)) > mathTolerance {
+			t.Errorf("value %v: payouts %v, want LONG %v", tc.value, payouts, tc.long)
+		}
+	}
+
+	for _, value := range []float64{math.NaN(), math.Inf(1)} {
+		if _, err := scalarPayouts(market, value); err == nil {
+			t.Errorf("value %v accepted", value)
+		}
+	}
+
+	market.Outcomes = market.Outcomes[:1]
+	if _, err := scalarPayouts(market, 35); err == nil {
+		t.Error("market without SHORT accepted")
+	}
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// 负风险转换方向
+const (
+	ConvertNoToYes = "no_to_yes" // 一个市场的 NO 份额转换为组内其他每个市场的 YES 份额
+	ConvertYesToNo = "yes_to_no" // 组内其他每个市场的 YES 份额转换回一个市场的 NO 份额
+)
+
+// PositionConversion 负风险转换的结果
+type PositionConversion struct {
+	MarketID  uint    `json:"market_id"`
+	Direction string  `json:"direction"`
+	Shares    float64 `json:"shares"`
+	Markets   []uint  `json:"markets"` // 获得或交回 YES 份额的其他市场
+}
+
+// ConvertPositions 互斥组内的负风险转换。组内恰好一个市场结算为 YES（见 checkGroupResolution），因此一个市场的 NO 份额与组内
+// 其他每个市场各一份 YES 份额的价值相同：no_to_yes 交回 shares 份 NO 获得其他每个市场各 shares 份 YES，
+// yes_to_no 反之。已结算为 NO 的市场不参与转换。持仓成本随份额转移，不产生积分变动。
+func (s *TradingService) ConvertPositions(userID, marketID uint, shares float64, direction string) (*PositionConversion, error) {
+	if direction != ConvertNoToYes && direction != ConvertYesToNo {
+		return nil, errors.New("invalid conversion direction")
+	}
+	if shares <= 0 {
+		return nil, errors.New("shares must be positive")
+	}
+
+	market, err := s.marketRepo.FindByID(marketID)
+	if err != nil {
+		return nil, err
+	}
+	group, err := groupMarketIDs(s.db, market)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, errors.New("market is not in a mutually exclusive event")
+	}
+
+	unlock := s.engine.lockMarkets(group)
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 按 ID 升序锁定组内所有市场的结果选项，与下单和结算串行
+	for _, id := range group {
+		if err := lockMarketRows(tx, id); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	source, others, err := conversionMarkets(tx, marketID, group)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	conversion := &PositionConversion{
+		MarketID:  marketID,
+		Direction: direction,
+		Shares:    shares,
+	}
+	for _, other := range others {
+		conversion.Markets = append(conversion.Markets, other.ID)
+	}
+
+	if direction == ConvertNoToYes {
+		err = s.convertNoToYes(tx, userID, source, others, shares)
+	} else {
+		err = s.convertYesToNo(tx, userID, source, others, shares)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	balance, err := s.currentBalance(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	description := fmt.Sprintf("Convert %.4f NO shares into YES shares of %d markets", shares, len(others))
+	if direction == ConvertYesToNo {
+		description = fmt.Sprintf("Convert YES shares of %d markets into %.4f NO shares", len(others), shares)
+	}
+	if err := tx.Create(&model.Transaction{
+		UserID:       userID,
+		Type:         "neg_risk_convert",
+		Amount:       0,
+		BalanceAfter: balance,
+		MarketID:     &marketID,
+		Description:  description,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return conversion, nil
+}
+
+// conversionMarkets 读取转换涉及的市场：源市场须未结算，组内其他市场须未结算或已结算为 NO。
+// 返回源市场和参与转换的其他市场（不含已结算为 NO 的市场）。
+func conversionMarkets(tx *gorm.DB, marketID uint, group []uint) (*model.Market, []model.Market, error) {
+	var markets []model.Market
+	if err := tx.Preload("Outcomes").
+		Where("id IN ?", group).
+		Order("id ASC").
+		Find(&markets).Error; err != nil {
+		return nil, nil, err
+	}
+
+	open := func(status string) bool { return status == "active" || status == "halted" || status == "closed" }
+
+	var source *model.Market
+	var others []model.Market
+	for i := range markets {
+		market := &markets[i]
+		if market.ID == marketID {
+			if !open(market.Status) {
+				return nil, nil, errors.New("positions can only be converted before the market is resolved")
+			}
+			source = market
+			continue
+		}
+
+		switch {
+		case open(market.Status):
+			others = append(others, *market)
+		case market.Status == "resolved":
+			yesID, _ := outcomeNamed(market.Outcomes, OutcomeYes)
+			if market.WinningOutcome != nil && *market.WinningOutcome == yesID {
+				return nil, nil, ErrGroupResolvedYes
+			}
+		default:
+			return nil, nil, fmt.Errorf("market %d is %s; every other market in the event must be open or resolved NO", market.ID, market.Status)
+		}
+	}
+	if source == nil {
+		return nil, nil, errors.New("market not found")
+	}
+	if len(others) == 0 {
+		return nil, nil, errors.New("no other open markets in this event")
+	}
+	return source, others, nil
+}
+
+// convertNoToYes 交回源市场 shares 份 NO，获得其他每个市场各 shares 份 YES。
+// NO 的持仓成本按各市场 YES 的当前价格分摊到新的 YES 份额。
+func (s *TradingService) convertNoToYes(tx *gorm.DB, userID uint, source *model.Market, others []model.Market, shares float64) error {
+	noID, _ := outcomeNamed(source.Outcomes, OutcomeNo)
+	avgPrice, err := s.takeShares(tx, userID, source.ID, noID, shares)
+	if err != nil {
+		return err
+	}
+
+	var total float64
+	for _, other := range others {
+		total += outcomePrice(other.Outcomes, OutcomeYes)
+	}
+
+	for i := range others {
+		other := &others[i]
+		yesID, _ := outcomeNamed(other.Outcomes, OutcomeYes)
+		basis := avgPrice / float64(len(others))
+		if total > 0 {
+			basis = avgPrice * outcomePrice(other.Outcomes, OutcomeYes) / total
+		}
+		if err := s.giveShares(tx, userID, other, yesID, shares, basis); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertYesToNo 交回其他每个市场各 shares 份 YES，获得源市场 shares 份 NO，
+// NO 的成本价为交回的各 YES 持仓成本价之和
+func (s *TradingService) convertYesToNo(tx *gorm.DB, userID uint, source *model.Market, others []model.Market, shares float64) error {
+	var basis float64
+	for _, other := range others {
+		yesID, _ := outcomeNamed(other.Outcomes, OutcomeYes)
+		avgPrice, err := s.takeShares(tx, userID, other.ID, yesID, shares)
+		if err != nil {
+			return err
+		}
+		basis += avgPrice
+	}
+
+	noID, _ := outcomeNamed(source.Outcomes, OutcomeNo)
+	return s.giveShares(tx, userID, source, noID, shares, basis)
+}
+
+// takeShares 从用户未冻结的持仓中扣除份额，返回持仓成本价
+func (s *TradingService) takeShares(tx *gorm.DB, userID, marketID, outcomeID uint, shares float64) (float64, error) {
+	var position model.Position
+	err := tx.Where("user_id = ? AND market_id = ? AND outcome_id = ?", userID, marketID, outcomeID).
+		First(&position).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && position.Shares-position.LockedShares < shares) {
+		return 0, fmt.Errorf("insufficient unlocked shares in market %d to convert", marketID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.updatePosition(tx, userID, marketID, outcomeID, "sell", shares, 0); err != nil {
+		return 0, err
+	}
+	return position.AvgPrice, addOutcomeShares(tx, outcomeID, -shares)
+}
+
+// giveShares 按成本价 basis 为用户增加持仓份额，并检查持仓限额
+func (s *TradingService) giveShares(tx *gorm.DB, userID uint, market *model.Market, outcomeID uint, shares, basis float64) error {
+	if err := s.updatePosition(tx, userID, market.ID, outcomeID, "buy", shares, basis); err != nil {
+		return err
+	}
+
+	limits, err := loadPositionLimits(tx, market)
+	if err != nil {
+		return err
+	}
+	if err := limits.checkExposure(tx, userID, market.ID, []uint{outcomeID}); err != nil {
+		return err
+	}
+	return addOutcomeShares(tx, outcomeID, shares)
+}
+
+// outcomePrice 按名称（不区分大小写）查找结果选项的当前价格
+func outcomePrice(outcomes []model.Outcome, name string) float64 {
+	for _, outcome := range outcomes {
+		if strings.EqualFold(outcome.OutcomeName, name) {
+			return outcome.CurrentPrice
+		}
+	}
+	return 0
+}
+
+// addOutcomeShares 调整单个结果选项的流通份额
+func addOutcomeShares(tx *gorm.DB, outcomeID uint, shares float64) error {
+	return tx.Model(&model.Outcome{}).
+		Where("id = ?", outcomeID).
+		UpdateColumn("total_shares", gorm.Expr("total_shares + ?", shares)).Error
+}
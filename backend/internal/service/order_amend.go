@@ -0,0 +1,206 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm/clause"
+)
+
+// AmendOrderParams 改单参数，为空的字段保持不变
+type AmendOrderParams struct {
+	Price  *float64
+	Shares *float64 // 新的订单总份额，须大于已成交份额
+}
+
+// AmendOrder 修改挂单的价格和 / 或份额，订单 ID 不变。
+// 仅减少份额时保留时间优先；改价或增加份额视为重新排队，改价后可能立即与对手盘成交（沿用下单时的自成交保护模式）。
+// 冻结资金或份额在同一事务内按差额调整，并记录订单变更。
+func (s *TradingService) AmendOrder(orderID, userID uint, params AmendOrderParams) (*model.Order, error) {
+	if params.Price == nil && params.Shares == nil {
+		return nil, errors.New("nothing to amend")
+	}
+
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != userID {
+		return nil, errors.New("order not found")
+	}
+	market, err := s.marketRepo.FindByID(order.MarketID)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := s.engine.lockMarket(order.MarketID)
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	mm, err := loadMarketMaker(tx, market)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// 在事务内重新加载并锁定订单（不带关联，避免保存时写入关联记录）
+	order = &model.Order{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(order, orderID).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if order.Status != "pending" && order.Status != "partially_filled" {
+		tx.Rollback()
+		return nil, errors.New("order cannot be amended")
+	}
+
+	oldPrice, oldShares := order.Price, order.Shares
+	newPrice, newShares := oldPrice, oldShares
+	if params.Price != nil {
+		newPrice = *params.Price
+	}
+	if params.Shares != nil {
+		newShares = *params.Shares
+	}
+	if newPrice <= 0 || newPrice > 1 {
+		tx.Rollback()
+		return nil, errors.New("price must be between 0 and 1")
+	}
+	if newShares <= order.FilledShares+shareEpsilon {
+		tx.Rollback()
+		return nil, errors.New("shares must be greater than the filled shares")
+	}
+	if newPrice == oldPrice && newShares == oldShares {
+		tx.Rollback()
+		return nil, errors.New("nothing to amend")
+	}
+
+	priceChanged := newPrice != oldPrice
+	keepPriority := !priceChanged && newShares < oldShares
+
+	// 重新排队的改单与新下单一样需要市场可交易并遵守持仓限制；仅减少份额总是允许
+	var limits positionLimits
+	if !keepPriority {
+		if err := tx.Select("status").First(market, market.ID).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := marketTradingError(market.Status); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if mm.outcomes[mm.index[order.OutcomeID]].Status == "halted" {
+			tx.Rollback()
+			return nil, ErrOutcomeHalted
+		}
+		if limits, err = loadPositionLimits(tx, market); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := limits.checkOrderSize(newShares); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	var result *matchResult
+	filledBefore := order.FilledShares
+	before := mm.prices()
+	switch {
+	case priceChanged:
+		// 按原价格释放全部冻结，以新价格撮合后再为剩余部分冻结
+		if err := s.releaseShares(tx, order, oldShares-order.FilledShares); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		order.Price, order.Shares = newPrice, newShares
+		if result, err = s.matchOrder(tx, mm, order); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if cancelSelfTradeRemainder(order, result) {
+			break
+		}
+		if remaining := order.Shares - order.FilledShares; remaining > shareEpsilon {
+			if err := s.reserveOrder(tx, order, remaining); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+	case newShares > oldShares:
+		order.Shares = newShares
+		if err := s.reserveOrder(tx, order, newShares-oldShares); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	default:
+		if err := s.releaseShares(tx, order, oldShares-newShares); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		order.Shares = newShares
+	}
+
+	if !keepPriority {
+		now := time.Now()
+		order.PriorityAt = &now
+	}
+	if err := tx.Save(order).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Create(&model.OrderHistory{
+		OrderID:      order.ID,
+		Action:       "amended",
+		OldPrice:     oldPrice,
+		NewPrice:     newPrice,
+		OldShares:    oldShares,
+		NewShares:    newShares,
+		PriorityKept: keepPriority,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if !keepPriority && order.OrderType == "buy" {
+		if err := limits.checkExposure(tx, userID, order.MarketID, []uint{order.OutcomeID}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := s.checkCircuitBreakers(tx, market, mm, before, order.OutcomeID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	if order.FilledShares > filledBefore {
+		go s.evaluateConditionalOrders(order.MarketID)
+	}
+	return order, nil
+}
+
+// GetOrderHistory 获取用户订单的变更记录
+func (s *TradingService) GetOrderHistory(orderID, userID uint) ([]model.OrderHistory, error) {
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != userID {
+		return nil, errors.New("order not found")
+	}
+	return s.orderRepo.FindHistoryByOrderID(orderID)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// shareEpsilon 份额比较的浮点误差容忍度
+const shareEpsilon = 1e-9
+
+// bookOrder 订单簿中的挂单
+type bookOrder struct {
+	Order     *model.Order // 挂单行，撮合时由 lockBookCandidates 加锁读取
+	UserID    uint
+	Price     float64
+	Remaining float64
+}
+
+// bookCandidates 读取与指定方向、限价可撮合的对手挂单，按价格优先、时间优先排列。
+// 订单簿以数据库中的挂单为准：撮合时调用方已锁定市场的结果选项行，多个实例读到的订单簿一致，
+// 同一事务内先挂出的订单（如批量下单中靠前的订单）也会被后续订单看到。
+// 已过有效期的 GTD 订单即使尚未被定期清理撤销，也不参与撮合。
+func bookCandidates(tx *gorm.DB, outcomeID uint, side string, limit float64) ([]bookOrder, error) {
+	query := tx.Model(&model.Order{}).
+		Where("outcome_id = ? AND status IN ?", outcomeID, []string{"pending", "partially_filled"}).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	if side == "buy" {
+		query = query.Where("order_type = ? AND price <= ?", "sell", limit).Order("price ASC")
+	} else {
+		query = query.Where("order_type = ? AND price >= ?", "buy", limit).Order("price DESC")
+	}
+
+	var orders []model.Order
+	if err := query.Order("COALESCE(priority_at, created_at) ASC, id ASC").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	candidates := make([]bookOrder, 0, len(orders))
+	for i := range orders {
+		order := &orders[i]
+		candidates = append(candidates, bookOrder{
+			Order:     order,
+			UserID:    order.UserID,
+			Price:     order.Price,
+			Remaining: order.Shares - order.FilledShares,
+		})
+	}
+	return candidates, nil
+}
+
+// lockBookCandidates 同 bookCandidates，但以一次 SELECT ... FOR UPDATE 锁定全部对手挂单，
+// 撮合时直接使用读到的订单行，无需逐笔重新查询
+func lockBookCandidates(tx *gorm.DB, outcomeID uint, side string, limit float64) ([]bookOrder, error) {
+	return bookCandidates(tx.Clauses(clause.Locking{Strength: "UPDATE"}), outcomeID, side, limit)
+}
+
+// matchingEngine 按市场串行化本实例内的撮合与结算，减少对数据库行锁的争用；
+// 跨实例的串行由事务内对结果选项行的 SELECT ... FOR UPDATE 保证
+type matchingEngine struct {
+	mu      sync.Mutex
+	markets map[uint]*sync.Mutex
+}
+
+func newMatchingEngine() *matchingEngine {
+	return &matchingEngine{
+		markets: make(map[uint]*sync.Mutex),
+	}
+}
+
+// lockMarket 锁定市场，返回解锁函数
+func (e *matchingEngine) lockMarket(marketID uint) func() {
+	e.mu.Lock()
+	m, ok := e.markets[marketID]
+	if !ok {
+		m = &sync.Mutex{}
+		e.markets[marketID] = m
+	}
+	e.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
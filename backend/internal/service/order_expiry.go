@@ -0,0 +1,110 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CancelMarketOrders 撤销市场内所有挂单并释放冻结，同时撤销条件单（市场离开 active 状态时调用）
+func (s *TradingService) CancelMarketOrders(marketID uint, reason string) (int, error) {
+	if err := cancelConditionalOrders(s.db, reason, "market_id = ?", marketID); err != nil {
+		return 0, err
+	}
+	return s.cancelOpenOrders(marketID, nil, reason)
+}
+
+// cancelOpenOrders 在单个事务内撤销市场中满足条件的挂单，返回撤销数量
+func (s *TradingService) cancelOpenOrders(marketID uint, scope func(*gorm.DB) *gorm.DB, reason string) (int, error) {
+	unlock := s.engine.lockMarket(marketID)
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockMarketRows(tx, marketID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	orders, err := s.cancelOpenOrdersTx(tx, marketID, scope, reason)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+
+	return len(orders), nil
+}
+
+// cancelOpenOrdersTx 在事务内撤销市场中满足条件的挂单并释放冻结，返回被撤销的订单。
+// 调用方需持有市场锁并已锁定结果选项。
+func (s *TradingService) cancelOpenOrdersTx(tx *gorm.DB, marketID uint, scope func(*gorm.DB) *gorm.DB, reason string) ([]model.Order, error) {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("market_id = ? AND status IN ?", marketID, []string{"pending", "partially_filled"})
+	if scope != nil {
+		query = scope(query)
+	}
+
+	var orders []model.Order
+	if err := query.Order("id ASC").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		if err := s.cancelLockedOrder(tx, &orders[i], reason); err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+// RunOrderExpirer 定期撤销已过期的 GTD 订单和已不在交易中的市场里残留的挂单，并恢复冷却期结束的熔断暂停
+func (s *TradingService) RunOrderExpirer(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.expireOrders()
+		s.resumeExpiredHalts()
+	}
+}
+
+// expireOrders 执行一轮过期订单清理
+func (s *TradingService) expireOrders() {
+	now := time.Now()
+
+	marketIDs, err := s.orderRepo.FindMarketsWithExpiredOrders(now)
+	if err != nil {
+		log.Printf("Failed to find expired orders: %v", err)
+	}
+	for _, marketID := range marketIDs {
+		expired := func(db *gorm.DB) *gorm.DB {
+			return db.Where("time_in_force = ? AND expires_at <= ?", TimeInForceGTD, now)
+		}
+		if _, err := s.cancelOpenOrders(marketID, expired, "expired"); err != nil {
+			log.Printf("Failed to expire orders in market %d: %v", marketID, err)
+		}
+	}
+
+	marketIDs, err = s.orderRepo.FindInactiveMarketsWithOpenOrders()
+	if err != nil {
+		log.Printf("Failed to find orders in inactive markets: %v", err)
+	}
+	for _, marketID := range marketIDs {
+		if _, err := s.CancelMarketOrders(marketID, "market_closed"); err != nil {
+			log.Printf("Failed to cancel orders in market %d: %v", marketID, err)
+		}
+	}
+}
@@ -0,0 +1,647 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// configResolutionDisputeWindowMinutes 结算提议的争议期（分钟），0 表示提议后立即结算
+const configResolutionDisputeWindowMinutes = "resolution_dispute_window_minutes"
+
+// payoutEpsilon 支付比例合计与 1 之间允许的误差
+const payoutEpsilon = 1e-4
+
+// 结算错误
+var (
+	ErrNoResolution        = errors.New("market has no pending or finalized resolution")
+	ErrDisputeWindowClosed = errors.New("dispute window has closed")
+	ErrDisputeExists       = errors.New("you have already disputed this resolution")
+)
+
+// ResolveMarket 提议市场的结算结果（管理员）：区间市场按结算数值，其他市场按支付向量。
+// 市场停止交易并撤销所有挂单，进入争议期；争议期结束且没有未处理的争议时自动结算，争议期配置为 0 时立即结算。
+func (s *MarketService) ResolveMarket(marketID uint, input ResolutionInput, proposedBy uint) (*model.MarketResolution, error) {
+	market, err := s.marketRepo.FindByID(marketID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMarketTransition(market.Status, "proposed"); err != nil {
+		return nil, err
+	}
+	payouts, err := resolutionPayoutsFor(market, input)
+	if err != nil {
+		return nil, err
+	}
+
+	// 互斥组内的市场结算为 YES 时会同时结算组内其他市场
+	unlock, err := s.lockResolutionScope(market)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 先锁定结果选项，与下单串行
+	if err := lockResolutionRows(tx, market); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := checkGroupResolution(tx, market, payouts); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	resolution, err := s.proposeResolution(tx, marketID, market.Status, payouts, input.Value, proposedBy)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return resolution, nil
+}
+
+// proposeResolution 在事务内将市场变更为待结算、撤销挂单并创建结算提议，争议期为 0 时直接结算。
+// value 为区间市场的结算数值，其他市场为空。
+func (s *MarketService) proposeResolution(tx *gorm.DB, marketID uint, from string, payouts map[uint]float64, value *float64, proposedBy uint) (*model.MarketResolution, error) {
+	proposed, err := transitionMarket(tx, marketID, from, "proposed", &proposedBy, "resolution_proposed", nil)
+	if err != nil {
+		return nil, err
+	}
+	if !proposed {
+		return nil, ErrMarketStatusChanged
+	}
+
+	if _, err := s.trading.cancelOpenOrdersTx(tx, marketID, nil, "market_resolved"); err != nil {
+		return nil, err
+	}
+	if err := cancelConditionalOrders(tx, "market_resolved", "market_id = ?", marketID); err != nil {
+		return nil, err
+	}
+
+	// 默认不设争议期，提议即结算，与引入争议期之前的结算流程一致；运营方可按需开启
+	window, err := configFloat(tx, configResolutionDisputeWindowMinutes, 0)
+	if err != nil {
+		return nil, err
+	}
+	resolution := &model.MarketResolution{
+		MarketID:        marketID,
+		OutcomeID:       winningOutcome(payouts),
+		Value:           value,
+		Status:          "proposed",
+		ProposedBy:      proposedBy,
+		DisputeDeadline: time.Now().Add(time.Duration(window * float64(time.Minute))),
+	}
+	for _, outcomeID := range sortedOutcomeIDs(payouts) {
+		resolution.Payouts = append(resolution.Payouts, model.ResolutionPayout{
+			OutcomeID: outcomeID,
+			Payout:    payouts[outcomeID],
+		})
+	}
+	// 支付向量随提议一并创建
+	if err := tx.Create(resolution).Error; err != nil {
+		return nil, err
+	}
+
+	if window <= 0 {
+		if err := s.finalizeResolution(tx, resolution, &proposedBy); err != nil {
+			return nil, err
+		}
+	}
+	return resolution, nil
+}
+
+// FinalizeResolution 管理员确认结算提议并立即结算，未处理的争议视为驳回
+func (s *MarketService) FinalizeResolution(marketID, adminID uint) (*model.MarketResolution, error) {
+	return s.finalizeMarket(marketID, &adminID, false)
+}
+
+// finalizeMarket 锁定市场待结算的提议并结算。auto 为 true 时（调度触发）仅在争议期已结束且
+// 没有未处理的争议时结算，不满足条件或已被其他实例结算时返回 nil, nil。
+func (s *MarketService) finalizeMarket(marketID uint, finalizedBy *uint, auto bool) (*model.MarketResolution, error) {
+	market, err := s.marketRepo.FindByID(marketID)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := s.lockResolutionScope(market)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockMarketRows(tx, marketID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	resolution, err := lockResolution(tx, marketID, "proposed")
+	if auto && errors.Is(err, ErrNoResolution) {
+		tx.Rollback()
+		return nil, nil
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if auto {
+		var disputes int64
+		if err := tx.Model(&model.ResolutionDispute{}).
+			Where("resolution_id = ? AND status = ?", resolution.ID, "open").
+			Count(&disputes).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if disputes > 0 || resolution.DisputeDeadline.After(time.Now()) {
+			tx.Rollback()
+			return nil, nil
+		}
+	}
+
+	if err := s.finalizeResolution(tx, resolution, finalizedBy); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return resolution, nil
+}
+
+// finalizeResolution 在事务内结算提议：市场变更为已结算，记录各结果选项的支付比例，
+// 驳回未处理的争议并结算所有持仓；互斥组内的市场结算为 YES 时同时将组内其他市场结算为 NO。
+// finalizedBy 为空表示争议期结束后自动结算。
+func (s *MarketService) finalizeResolution(tx *gorm.DB, resolution *model.MarketResolution, finalizedBy *uint) error {
+	payouts, err := resolutionPayouts(tx, resolution)
+	if err != nil {
+		return err
+	}
+
+	resolvedBy := resolution.ProposedBy
+	if finalizedBy != nil {
+		resolvedBy = *finalizedBy
+	}
+	resolved, err := transitionMarket(tx, resolution.MarketID, "proposed", "resolved", finalizedBy, "resolution_finalized",
+		map[string]interface{}{
+			"winning_outcome": resolution.OutcomeID,
+			"resolved_value":  resolution.Value,
+			"resolved_by":     resolvedBy,
+		})
+	if err != nil {
+		return err
+	}
+	if !resolved {
+		return ErrMarketStatusChanged
+	}
+
+	// 未列出的结果选项支付 0
+	if err := tx.Model(&model.Outcome{}).
+		Where("market_id = ?", resolution.MarketID).
+		Update("payout", 0).Error; err != nil {
+		return err
+	}
+	for outcomeID, payout := range payouts {
+		if err := tx.Model(&model.Outcome{}).
+			Where("id = ?", outcomeID).
+			Update("payout", payout).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	resolution.Status = "finalized"
+	resolution.FinalizedBy = finalizedBy
+	resolution.FinalizedAt = &now
+	if err := tx.Omit(clause.Associations).Save(resolution).Error; err != nil {
+		return err
+	}
+
+	if err := reviewDisputes(tx, resolution.ID, "rejected", finalizedBy, now); err != nil {
+		return err
+	}
+	if err := s.settlePositions(tx, resolution, payouts); err != nil {
+		return err
+	}
+	return s.resolveGroupSiblings(tx, resolution, payouts, finalizedBy)
+}
+
+// settlePositions 在事务内按支付向量结算市场的所有持仓：每个持仓获得 份额 × 所属结果选项的支付比例
+func (s *MarketService) settlePositions(tx *gorm.DB, resolution *model.MarketResolution, payouts map[uint]float64) error {
+	marketID := resolution.MarketID
+
+	var positions []model.Position
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("market_id = ? AND shares > ?", marketID, shareEpsilon).
+		Order("id ASC").
+		Find(&positions).Error; err != nil {
+		return err
+	}
+
+	for _, position := range positions {
+		fraction := payouts[position.OutcomeID]
+		if fraction > 0 {
+			// 获胜方：每份额获得支付比例对应的虚拟积分，全额获胜为 1.0
+			payout := position.Shares * fraction
+			description := "Market settlement - win"
+			if fraction < 1 {
+				description = fmt.Sprintf("Market settlement - %.4f shares paid %.4f each", position.Shares, fraction)
+			}
+
+			balance, err := s.trading.adjustBalance(tx, position.UserID, payout)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&model.Transaction{
+				UserID:       position.UserID,
+				Type:         "settlement_win",
+				Amount:       payout,
+				BalanceAfter: balance,
+				MarketID:     &marketID,
+				ResolutionID: &resolution.ID,
+				Description:  description,
+			}).Error; err != nil {
+				return err
+			}
+		} else {
+			// 失败方：记录损失
+			balance, err := s.trading.currentBalance(tx, position.UserID)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&model.Transaction{
+				UserID:       position.UserID,
+				Type:         "settlement_loss",
+				Amount:       0,
+				BalanceAfter: balance,
+				MarketID:     &marketID,
+				ResolutionID: &resolution.ID,
+				Description:  "Market settlement - loss",
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UnresolveMarket 管理员撤回待结算的提议，或撤销已完成的结算（冲正所有 settlement_win 交易），
+// 市场回到 closed 状态。next 非空时在同一事务内以新的结算输入重新提议结算。
+// 返回被撤回或撤销的提议，以及新的提议（如有）。
+func (s *MarketService) UnresolveMarket(marketID, adminID uint, reason string, next *ResolutionInput) (*model.MarketResolution, *model.MarketResolution, error) {
+	market, err := s.marketRepo.FindByID(marketID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var newPayouts map[uint]float64
+	if next != nil {
+		if newPayouts, err = resolutionPayoutsFor(market, *next); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	unlock, err := s.lockResolutionScope(market)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockResolutionRows(tx, market); err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	resolution, err := lockResolution(tx, marketID, "proposed", "finalized")
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	var changed bool
+	if resolution.Status == "proposed" {
+		changed, err = transitionMarket(tx, marketID, "proposed", "closed", &adminID, "resolution_withdrawn", nil)
+		if err == nil && changed {
+			resolution.Status = "withdrawn"
+			err = reviewDisputes(tx, resolution.ID, "upheld", &adminID, now)
+		}
+	} else {
+		changed, err = s.reverseFinalized(tx, resolution, adminID)
+		if err == nil && changed {
+			// 互斥组内因本市场结算为 YES 而自动结算为 NO 的市场一并撤销
+			err = s.reverseGroupSiblings(tx, resolution, adminID, reason, now)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	if !changed {
+		tx.Rollback()
+		return nil, nil, ErrMarketStatusChanged
+	}
+
+	resolution.ReversedBy = &adminID
+	resolution.ReversedAt = &now
+	resolution.ReverseReason = reason
+	if err := tx.Save(resolution).Error; err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	// 重新提议：市场已为 closed，没有需要撤销的挂单
+	var proposal *model.MarketResolution
+	if next != nil {
+		if err := checkGroupResolution(tx, market, newPayouts); err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+		if proposal, err = s.proposeResolution(tx, marketID, "closed", newPayouts, next.Value, adminID); err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, nil, err
+	}
+
+	return resolution, proposal, nil
+}
+
+// reverseFinalized 在事务内撤销已完成的结算：市场回到 closed，清空结算结果并冲正结算交易。
+// 市场状态已被修改时返回 false。
+func (s *MarketService) reverseFinalized(tx *gorm.DB, resolution *model.MarketResolution, adminID uint) (bool, error) {
+	changed, err := transitionMarket(tx, resolution.MarketID, "resolved", "closed", &adminID, "resolution_reversed",
+		map[string]interface{}{
+			"winning_outcome": nil,
+			"resolved_value":  nil,
+			"resolved_by":     nil,
+		})
+	if err != nil || !changed {
+		return changed, err
+	}
+
+	resolution.Status = "reversed"
+	if err := tx.Model(&model.Outcome{}).
+		Where("market_id = ?", resolution.MarketID).
+		Update("payout", nil).Error; err != nil {
+		return false, err
+	}
+	return true, s.reverseSettlement(tx, resolution)
+}
+
+// reverseSettlement 在事务内冲正结算提议的所有 settlement_win 交易。
+// 结算所得可能已被使用，冲正后余额允许为负。
+func (s *MarketService) reverseSettlement(tx *gorm.DB, resolution *model.MarketResolution) error {
+	var wins []model.Transaction
+	if err := tx.Where("resolution_id = ? AND type = ?", resolution.ID, "settlement_win").
+		Order("id ASC").
+		Find(&wins).Error; err != nil {
+		return err
+	}
+
+	for _, win := range wins {
+		if err := tx.Model(&model.User{}).
+			Where("id = ?", win.UserID).
+			UpdateColumn("virtual_balance", gorm.Expr("virtual_balance - ?", win.Amount)).Error; err != nil {
+			return err
+		}
+
+		balance, err := s.trading.currentBalance(tx, win.UserID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&model.Transaction{
+			UserID:       win.UserID,
+			Type:         "settlement_reversal",
+			Amount:       -win.Amount,
+			BalanceAfter: balance,
+			MarketID:     win.MarketID,
+			ResolutionID: &resolution.ID,
+			Description:  fmt.Sprintf("Reverse settlement transaction %d", win.ID),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileDispute 用户在争议期内对市场的结算提议提出争议，仅限持有该市场份额的用户，每个提议限一次
+func (s *MarketService) FileDispute(marketID, userID uint, reason string) (*model.ResolutionDispute, error) {
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 锁定提议，与争议期结束后的自动结算串行
+	resolution, err := lockResolution(tx, marketID, "proposed")
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !time.Now().Before(resolution.DisputeDeadline) {
+		tx.Rollback()
+		return nil, ErrDisputeWindowClosed
+	}
+
+	var positions int64
+	if err := tx.Model(&model.Position{}).
+		Where("user_id = ? AND market_id = ? AND shares > ?", userID, marketID, shareEpsilon).
+		Count(&positions).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if positions == 0 {
+		tx.Rollback()
+		return nil, errors.New("only users holding shares in this market can dispute its resolution")
+	}
+
+	dispute := &model.ResolutionDispute{
+		ResolutionID: resolution.ID,
+		MarketID:     marketID,
+		UserID:       userID,
+		Reason:       reason,
+		Status:       "open",
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(dispute)
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, ErrDisputeExists
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return dispute, nil
+}
+
+// GetResolutions 获取市场的结算提议及争议（管理员）
+func (s *MarketService) GetResolutions(marketID uint) ([]model.MarketResolution, error) {
+	if _, err := s.marketRepo.FindByID(marketID); err != nil {
+		return nil, err
+	}
+	return s.marketRepo.FindResolutions(marketID)
+}
+
+// finalizeDueResolutions 结算争议期已结束且没有未处理争议的提议
+func (s *MarketService) finalizeDueResolutions(now time.Time) {
+	marketIDs, err := s.marketRepo.FindResolutionsDueToFinalize(now)
+	if err != nil {
+		log.Printf("Failed to find resolutions due to finalize: %v", err)
+		return
+	}
+	for _, marketID := range marketIDs {
+		resolution, err := s.finalizeMarket(marketID, nil, true)
+		if err != nil {
+			log.Printf("Failed to finalize resolution of market %d: %v", marketID, err)
+			continue
+		}
+		if resolution != nil {
+			log.Printf("Market %d resolved after its dispute window", marketID)
+		}
+	}
+}
+
+// validatePayouts 校验支付向量：结果选项须属于该市场，每项支付比例在 0 到 1 之间且合计为 1
+func validatePayouts(market *model.Market, payouts map[uint]float64) error {
+	if len(payouts) == 0 {
+		return errors.New("payouts are required")
+	}
+
+	var total float64
+	for outcomeID, payout := range payouts {
+		if !hasOutcome(market, outcomeID) {
+			return errors.New("invalid winning outcome")
+		}
+		if payout < 0 || payout > 1 {
+			return errors.New("payout must be between 0 and 1")
+		}
+		total += payout
+	}
+	if math.Abs(total-1) > payoutEpsilon {
+		return fmt.Errorf("payouts must sum to 1, got %.6f", total)
+	}
+	return nil
+}
+
+// winningOutcome 返回支付比例为 1 的结果选项，按比例拆分时返回 nil
+func winningOutcome(payouts map[uint]float64) *uint {
+	for outcomeID, payout := range payouts {
+		if payout >= 1-payoutEpsilon {
+			id := outcomeID
+			return &id
+		}
+	}
+	return nil
+}
+
+// sortedOutcomeIDs 按 ID 升序返回支付向量中的结果选项
+func sortedOutcomeIDs(payouts map[uint]float64) []uint {
+	ids := make([]uint, 0, len(payouts))
+	for outcomeID := range payouts {
+		ids = append(ids, outcomeID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// resolutionPayouts 在事务内读取结算提议的支付向量
+func resolutionPayouts(tx *gorm.DB, resolution *model.MarketResolution) (map[uint]float64, error) {
+	if resolution.Payouts == nil {
+		if err := tx.Where("resolution_id = ?", resolution.ID).Find(&resolution.Payouts).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	payouts := make(map[uint]float64, len(resolution.Payouts))
+	for _, payout := range resolution.Payouts {
+		payouts[payout.OutcomeID] = payout.Payout
+	}
+	return payouts, nil
+}
+
+// lockResolution 在事务内锁定市场最近一个处于指定状态的结算提议
+func lockResolution(tx *gorm.DB, marketID uint, statuses ...string) (*model.MarketResolution, error) {
+	var resolution model.MarketResolution
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("market_id = ? AND status IN ?", marketID, statuses).
+		Order("id DESC").
+		First(&resolution).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoResolution
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resolution, nil
+}
+
+// reviewDisputes 在事务内处理提议下所有未处理的争议：提议被撤回时为 upheld，被结算时为 rejected
+func reviewDisputes(tx *gorm.DB, resolutionID uint, status string, reviewedBy *uint, now time.Time) error {
+	return tx.Model(&model.ResolutionDispute{}).
+		Where("resolution_id = ? AND status = ?", resolutionID, "open").
+		Updates(map[string]interface{}{
+			"status":      status,
+			"reviewed_by": reviewedBy,
+			"reviewed_at": now,
+		}).Error
+}
+
+// validateResolutionConfig 校验结算配置值，其他配置键直接通过
+func validateResolutionConfig(key, value string) error {
+	if key != configResolutionDisputeWindowMinutes {
+		return nil
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return errors.New("value must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+)
+
+func TestValidatePayouts(t *testing.T) {
+	market := &model.Market{Outcomes: []model.Outcome{{ID: 1}, {ID: 2}, {ID: 3}}}
+	for _, tc := range []struct {
+		name    string
+		payouts map[uint]float64
+		ok      bool
+	}{
+		{"winner", map[uint]float64{2: 1}, true},
+		{"split", map[uint]float64{1: 0.5, 3: 0.5}, true},
+		{"thirds", map[uint]float64{1: 1.0 / 3, 2: 1.0 / 3, 3: 1.0 / 3}, true},
+		{"empty", map[uint]float64{}, false},
+		{"foreign outcome", map[uint]float64{9: 1}, false},
+		{"negative", map[uint]float64{1: 1.5, 2: -0.5}, false},
+		{"under one", map[uint]float64{1: 0.5, 2: 0.4}, false},
+		{"over one", map[uint]float64{1: 0.6, 2: 0.6}, false},
+	} {
+		if err := validatePayouts(market, tc.payouts); (err == nil) != tc.ok {
+			t.Errorf("%s: got %v, want ok=%v", tc.name, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// 自成交保护模式：新订单将与同一用户的挂单成交时的处理方式
+const (
+	STPCancelNewest = "cancel_newest" // 撤销新订单的剩余部分，挂单保留
+	STPCancelOldest = "cancel_oldest" // 撤销挂单，新订单继续撮合
+	STPCancelBoth   = "cancel_both"   // 同时撤销挂单与新订单的剩余部分
+	STPDecrement    = "decrement"     // 双方按重叠份额扣减，不产生成交
+)
+
+// errStopMatching 由 onBook 返回，表示停止撮合（已成交部分保留）
+var errStopMatching = errors.New("stop matching")
+
+// validSelfTradePrevention 判断自成交保护模式是否有效
+func validSelfTradePrevention(mode string) bool {
+	switch mode {
+	case STPCancelNewest, STPCancelOldest, STPCancelBoth, STPDecrement:
+		return true
+	}
+	return false
+}
+
+// preventSelfTrade 按新订单的自成交保护模式处理与同一用户挂单的撮合，
+// 返回新订单被扣减的份额；需要停止撮合时返回 errStopMatching
+func (s *TradingService) preventSelfTrade(tx *gorm.DB, order, maker *model.Order, shares float64, result *matchResult) (float64, error) {
+	result.selfTradePrevented = true
+
+	switch order.SelfTradePrevention {
+	case STPDecrement:
+		if err := s.releaseShares(tx, maker, shares); err != nil {
+			return 0, err
+		}
+		maker.Shares -= shares
+		maker.PreventedShares += shares
+		if maker.Shares-maker.FilledShares <= shareEpsilon {
+			maker.Status = "cancelled"
+			maker.StatusReason = "self_trade_prevented"
+		}
+		if err := tx.Save(maker).Error; err != nil {
+			return 0, err
+		}
+
+		// 仅指定预算的市价单没有份额可扣减
+		if order.Shares > 0 {
+			order.Shares -= shares
+		}
+		order.PreventedShares += shares
+		return shares, nil
+	case STPCancelOldest, STPCancelBoth:
+		maker.PreventedShares += maker.Shares - maker.FilledShares
+		if err := s.cancelLockedOrder(tx, maker, "self_trade_prevented"); err != nil {
+			return 0, err
+		}
+		if order.SelfTradePrevention == STPCancelOldest {
+			return 0, nil
+		}
+	}
+
+	result.selfTradeStopped = true
+	return 0, errStopMatching
+}
+
+// cancelSelfTradeRemainder 自成交保护停止撮合或已扣减完新订单时，将新订单标记为撤销。
+// 返回 true 表示订单不再挂单。
+func cancelSelfTradeRemainder(order *model.Order, result *matchResult) bool {
+	if !result.selfTradePrevented {
+		return false
+	}
+
+	remaining := order.Shares - order.FilledShares
+	if remaining > shareEpsilon {
+		if !result.selfTradeStopped {
+			// 扣减后仍有剩余，按有效期类型正常处理
+			return false
+		}
+		order.PreventedShares += remaining
+	}
+	order.Status = "cancelled"
+	order.StatusReason = "self_trade_prevented"
+	return true
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/huabtc/polygame/backend/internal/model"
+)
+
+func TestSelfTradePreventionDefaultsAndValidation(t *testing.T) {
+	params := PlaceOrderParams{OrderType: "buy", Shares: 1, Price: 0.5}
+	if err := params.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if params.SelfTradePrevention != STPCancelNewest {
+		t.Errorf("default mode %q, want %q", params.SelfTradePrevention, STPCancelNewest)
+	}
+
+	for _, mode := range []string{STPCancelNewest, STPCancelOldest, STPCancelBoth, STPDecrement} {
+		params := PlaceOrderParams{OrderType: "buy", Shares: 1, Price: 0.5, SelfTradePrevention: mode}
+		if err := params.normalize(); err != nil {
+			t.Errorf("mode %q rejected: %v", mode, err)
+		}
+	}
+
+	params = PlaceOrderParams{OrderType: "buy", Shares: 1, Price: 0.5, SelfTradePrevention: "cancel_all"}
+	if err := params.normalize(); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
+
+func TestCancelNewestStopsMatching(t *testing.T) {
+	var s *TradingService
+	order := &model.Order{UserID: 1, Shares: 10, SelfTradePrevention: STPCancelNewest}
+	maker := &model.Order{UserID: 1, Shares: 5}
+	result := &matchResult{}
+
+	// cancel_newest 不修改挂单，无需数据库
+	reduced, err := s.preventSelfTrade(nil, order, maker, 5, result)
+	if !errors.Is(err, errStopMatching) || reduced != 0 {
+		t.Fatalf("got reduced=%v err=%v, want errStopMatching", reduced, err)
+	}
+	if !result.selfTradePrevented || !result.selfTradeStopped {
+		t.Errorf("result %+v, want prevented and stopped", result)
+	}
+
+	if !cancelSelfTradeRemainder(order, result) {
+		t.Fatal("remainder not cancelled")
+	}
+	if order.Status != "cancelled" || order.StatusReason != "self_trade_prevented" || order.PreventedShares != 10 {
+		t.Errorf("order %+v", order)
+	}
+}
+
+func TestDecrementedRemainderKeepsResting(t *testing.T) {
+	order := &model.Order{Shares: 6, FilledShares: 2}
+	result := &matchResult{selfTradePrevented: true}
+	if cancelSelfTradeRemainder(order, result) {
+		t.Error("order with shares left after decrement was cancelled")
+	}
+
+	order.Shares = 2
+	if !cancelSelfTradeRemainder(order, result) || order.StatusReason != "self_trade_prevented" {
+		t.Error("fully decremented order not closed")
+	}
+}
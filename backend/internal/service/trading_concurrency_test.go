@@ -0,0 +1,226 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/huabtc/polygame/backend/config"
+	"github.com/huabtc/polygame/backend/internal/model"
+	"github.com/huabtc/polygame/backend/internal/repository"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testInitialBalance = 10000.0
+	testInitialShares  = 200.0
+	testUsers          = 8
+	testOperations     = 400
+	testWorkers        = 16
+)
+
+// openTestDB 连接 TEST_DATABASE_URL 指向的 PostgreSQL 并迁移表结构，未设置时跳过测试
+func openTestDB(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := repository.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := NewConfigService(repository.NewConfigRepository(db)).SeedDefaults(); err != nil {
+		t.Fatalf("seed configs: %v", err)
+	}
+	return db
+}
+
+// newTestTradingService 按 main.go 的方式组装交易服务
+func newTestTradingService(db *gorm.DB) *TradingService {
+	return NewTradingService(
+		repository.NewOrderRepository(db),
+		repository.NewPositionRepository(db),
+		repository.NewUserRepository(db),
+		repository.NewMarketRepository(db),
+		repository.NewTransactionRepository(db),
+		repository.NewTradeRepository(db),
+		db,
+		config.Load(),
+	)
+}
+
+// TestConcurrentOrdersKeepLedgerConsistent 并发下单与撤单后，余额、冻结额与持仓均不为负，
+// 且余额与交易记录一致：virtual_balance 等于初始余额加全部交易金额，
+// virtual_balance + reserved_balance 等于初始余额加冻结与释放之外的交易金额
+func TestConcurrentOrdersKeepLedgerConsistent(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestTradingService(db)
+	suffix := time.Now().UnixNano()
+
+	market := model.Market{
+		Title:            fmt.Sprintf("Concurrency test %d", suffix),
+		Category:         "tech",
+		MarketType:       "binary",
+		Status:           "active",
+		BreakerPriceMove: 1, // 关闭熔断，避免暂停打断测试
+		CreatedBy:        1,
+		Outcomes:         []model.Outcome{{OutcomeName: "YES"}, {OutcomeName: "NO"}},
+	}
+	if err := db.Create(&market).Error; err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+
+	userIDs := make([]uint, testUsers)
+	for i := range userIDs {
+		user := model.User{
+			Username:       fmt.Sprintf("ct_%d_%d", suffix, i),
+			Email:          fmt.Sprintf("ct_%d_%d@example.com", suffix, i),
+			PasswordHash:   "x",
+			VirtualBalance: testInitialBalance,
+		}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		userIDs[i] = user.ID
+
+		// 初始持仓不经过积分，卖单才有份额可卖
+		for _, outcome := range market.Outcomes {
+			if err := db.Create(&model.Position{
+				UserID:    user.ID,
+				MarketID:  market.ID,
+				OutcomeID: outcome.ID,
+				Shares:    testInitialShares,
+				AvgPrice:  0.5,
+			}).Error; err != nil {
+				t.Fatalf("create position: %v", err)
+			}
+		}
+	}
+
+	var (
+		mu     sync.Mutex
+		orders = make(map[uint][]uint) // 用户已下的订单，供撤单随机选取
+		placed int
+	)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for range jobs {
+				userID := userIDs[rng.Intn(len(userIDs))]
+
+				mu.Lock()
+				own := orders[userID]
+				mu.Unlock()
+				if len(own) > 0 && rng.Intn(3) == 0 {
+					// 订单可能已成交或已撤销，错误是预期内的
+					_ = s.CancelOrder(own[rng.Intn(len(own))], userID)
+					continue
+				}
+
+				params := PlaceOrderParams{
+					MarketID:  market.ID,
+					OutcomeID: market.Outcomes[rng.Intn(len(market.Outcomes))].ID,
+					OrderType: []string{"buy", "sell"}[rng.Intn(2)],
+					Shares:    float64(1 + rng.Intn(20)),
+					Price:     float64(30+rng.Intn(41)) / 100,
+				}
+				if rng.Intn(5) == 0 {
+					params.OrderKind = OrderKindMarket
+					params.TimeInForce = TimeInForceIOC
+					if params.OrderType == "buy" && rng.Intn(2) == 0 {
+						params.Shares = 0
+						params.Budget = float64(1 + rng.Intn(20))
+					}
+				}
+
+				// 份额不足、超出限额等拒单同样是预期内的
+				order, err := s.PlaceOrder(userID, params)
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				orders[userID] = append(orders[userID], order.ID)
+				placed++
+				mu.Unlock()
+			}
+		}(suffix + int64(w))
+	}
+	for i := 0; i < testOperations; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if placed == 0 {
+		t.Fatal("no orders were placed")
+	}
+
+	for _, userID := range userIDs {
+		var user model.User
+		if err := db.First(&user, userID).Error; err != nil {
+			t.Fatalf("load user: %v", err)
+		}
+		if user.VirtualBalance < 0 || user.ReservedBalance < 0 {
+			t.Errorf("user %d: balance %.2f, reserved %.2f", userID, user.VirtualBalance, user.ReservedBalance)
+		}
+
+		var ledger, escrow float64
+		if err := db.Model(&model.Transaction{}).Where("user_id = ?", userID).
+			Select("COALESCE(SUM(amount), 0)").Scan(&ledger).Error; err != nil {
+			t.Fatalf("sum transactions: %v", err)
+		}
+		if err := db.Model(&model.Transaction{}).
+			Where("user_id = ? AND type IN ?", userID, []string{"order_reserve", "order_release"}).
+			Select("COALESCE(SUM(amount), 0)").Scan(&escrow).Error; err != nil {
+			t.Fatalf("sum escrow transactions: %v", err)
+		}
+		if got, want := roundCents(user.VirtualBalance), roundCents(testInitialBalance+ledger); got != want {
+			t.Errorf("user %d: balance %.2f, ledger says %.2f", userID, got, want)
+		}
+		if got, want := roundCents(user.VirtualBalance+user.ReservedBalance), roundCents(testInitialBalance+ledger-escrow); got != want {
+			t.Errorf("user %d: balance + reserved %.2f, ledger says %.2f", userID, got, want)
+		}
+
+		var reserved float64
+		if err := db.Model(&model.Order{}).
+			Where("user_id = ? AND status IN ?", userID, []string{"pending", "partially_filled"}).
+			Select("COALESCE(SUM(reserved_amount), 0)").Scan(&reserved).Error; err != nil {
+			t.Fatalf("sum reserved: %v", err)
+		}
+		if got, want := roundCents(user.ReservedBalance), roundCents(reserved); got != want {
+			t.Errorf("user %d: reserved balance %.2f, open orders reserve %.2f", userID, got, want)
+		}
+	}
+
+	var positions []model.Position
+	if err := db.Where("market_id = ?", market.ID).Find(&positions).Error; err != nil {
+		t.Fatalf("load positions: %v", err)
+	}
+	for _, position := range positions {
+		if position.Shares < -shareEpsilon || position.LockedShares < -shareEpsilon ||
+			position.LockedShares > position.Shares+shareEpsilon {
+			t.Errorf("position %d: shares %.4f, locked %.4f", position.ID, position.Shares, position.LockedShares)
+		}
+	}
+
+	var negative int64
+	if err := db.Model(&model.Order{}).Where("market_id = ? AND reserved_amount < 0", market.ID).
+		Count(&negative).Error; err != nil {
+		t.Fatalf("count orders: %v", err)
+	}
+	if negative > 0 {
+		t.Errorf("%d orders have a negative reserved amount", negative)
+	}
+}
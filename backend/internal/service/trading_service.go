@@ -2,11 +2,14 @@ package service
 
 import (
 	"errors"
+	"math"
 	"time"
 
+	"github.com/huabtc/polygame/backend/config"
 	"github.com/huabtc/polygame/backend/internal/model"
 	"github.com/huabtc/polygame/backend/internal/repository"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TradingService struct {
@@ -15,7 +18,10 @@ type TradingService struct {
 	userRepo     *repository.UserRepository
 	marketRepo   *repository.MarketRepository
 	txRepo       *repository.TransactionRepository
+	tradeRepo    *repository.TradeRepository
 	db           *gorm.DB
+	cfg          *config.Config
+	engine       *matchingEngine
 }
 
 func NewTradingService(
@@ -24,7 +30,9 @@ func NewTradingService(
 	userRepo *repository.UserRepository,
 	marketRepo *repository.MarketRepository,
 	txRepo *repository.TransactionRepository,
+	tradeRepo *repository.TradeRepository,
 	db *gorm.DB,
+	cfg *config.Config,
 ) *TradingService {
 	return &TradingService{
 		orderRepo:    orderRepo,
@@ -32,46 +40,226 @@ func NewTradingService(
 		userRepo:     userRepo,
 		marketRepo:   marketRepo,
 		txRepo:       txRepo,
+		tradeRepo:    tradeRepo,
 		db:           db,
+		cfg:          cfg,
+		engine:       newMatchingEngine(),
 	}
 }
 
-// PlaceOrder 下单
-func (s *TradingService) PlaceOrder(userID, marketID, outcomeID uint, orderType string, shares, price float64) (*model.Order, error) {
-	// 验证市场状态
+// PlaceOrderParams 下单参数
+type PlaceOrderParams struct {
+	MarketID    uint
+	OutcomeID   uint
+	OrderType   string
+	OrderKind   string  // limit, market，为空时按 limit 处理
+	Shares      float64 // 市价买单仅指定预算时可为 0
+	Price       float64 // 限价；市价单为可接受的最差价格，0 表示不限制
+	Budget      float64 // 市价买单的最大花费，0 表示不限制
+	MaxCost     float64 // 买入时可接受的最大总成本，0 表示不限制
+	MinProceeds float64 // 卖出时要求的最小总所得，0 表示不限制
+	TimeInForce string  // GTC, GTD, IOC, FOK，为空时按 GTC 处理
+	ExpiresAt   *time.Time
+
+	SelfTradePrevention string // 自成交保护模式，为空时按 cancel_newest 处理
+
+	IdempotencyKey string // 幂等键，为空表示不做幂等处理
+}
+
+// normalize 校验下单参数并填充默认值
+func (p *PlaceOrderParams) normalize() error {
+	if p.OrderKind == "" {
+		p.OrderKind = OrderKindLimit
+	}
+	if p.TimeInForce == "" {
+		p.TimeInForce = TimeInForceGTC
+	}
+	if p.SelfTradePrevention == "" {
+		p.SelfTradePrevention = STPCancelNewest
+	}
+	if !validSelfTradePrevention(p.SelfTradePrevention) {
+		return errors.New("invalid self-trade prevention mode")
+	}
+
+	switch p.OrderKind {
+	case OrderKindLimit:
+		if p.Shares <= 0 || p.Price <= 0 || p.Price > 1 {
+			return errors.New("limit orders require shares and a price between 0 and 1")
+		}
+		if p.Budget > 0 {
+			return errors.New("budget is only allowed for market orders")
+		}
+	case OrderKindMarket:
+		if p.OrderType == "sell" && (p.Shares <= 0 || p.Budget > 0) {
+			return errors.New("market sell orders require shares and do not accept a budget")
+		}
+		if p.OrderType == "buy" && p.Shares <= 0 && p.Budget <= 0 {
+			return errors.New("market buy orders require shares or a budget")
+		}
+		// 市价单不挂单：未指定最差价格时可吃到任意价格
+		if p.Price == 0 && p.OrderType == "buy" {
+			p.Price = 1
+		}
+		switch p.TimeInForce {
+		case TimeInForceGTC:
+			p.TimeInForce = TimeInForceIOC
+		case TimeInForceGTD:
+			return errors.New("market orders cannot be GTD")
+		}
+	default:
+		return errors.New("invalid order kind")
+	}
+
+	if p.TimeInForce == TimeInForceGTD {
+		if p.ExpiresAt == nil || !p.ExpiresAt.After(time.Now()) {
+			return errors.New("GTD orders require a future expires_at")
+		}
+	} else {
+		p.ExpiresAt = nil
+	}
+	return nil
+}
+
+// 订单类型
+const (
+	OrderKindLimit  = "limit"  // 限价单
+	OrderKindMarket = "market" // 市价单（带最差价格或预算）
+)
+
+// 订单有效期类型
+const (
+	TimeInForceGTC = "GTC" // 撤销前有效
+	TimeInForceGTD = "GTD" // 指定时间前有效
+	TimeInForceIOC = "IOC" // 立即成交剩余撤销
+	TimeInForceFOK = "FOK" // 全部成交否则撤销
+)
+
+// Quote 报价结果
+type Quote struct {
+	MarketID     uint             `json:"market_id"`
+	OutcomeID    uint             `json:"outcome_id"`
+	Side         string           `json:"side"`
+	Shares       float64          `json:"shares"`
+	FilledShares float64          `json:"filled_shares"`
+	AvgPrice     float64          `json:"avg_price"`
+	TotalCost    float64          `json:"total_cost"`
+	PriceBefore  float64          `json:"price_before"`
+	PriceAfter   float64          `json:"price_after"`
+	Fee          float64          `json:"fee"`          // 按吃单费率预估的手续费
+	PriceImpact  float64          `json:"price_impact"` // 成交均价相对成交前价格的变动比例
+	Prices       map[uint]float64 `json:"prices"`       // 成交后各结果选项价格
+}
+
+// GetQuote 预估按当前订单簿与做市商状态成交指定份额的结果，不产生任何成交
+func (s *TradingService) GetQuote(marketID, outcomeID uint, side string, shares float64) (*Quote, error) {
+	unlock := s.engine.lockMarket(marketID)
+	defer unlock()
+
 	market, err := s.marketRepo.FindByID(marketID)
 	if err != nil {
 		return nil, err
 	}
-	if market.Status != "active" {
-		return nil, errors.New("market is not active")
+	// 与下单相同的交易状态校验：下单会被拒绝时不给出报价
+	if err := marketTradingError(market.Status); err != nil {
+		return nil, err
+	}
+	if !hasOutcome(market, outcomeID) {
+		return nil, errors.New("invalid outcome")
 	}
 
-	// 计算总成本
-	totalCost := shares * price
+	mm := newMarketMaker(market, market.Outcomes)
+	if mm.outcomes[mm.index[outcomeID]].Status == "halted" {
+		return nil, ErrOutcomeHalted
+	}
 
-	// 验证用户余额（买入时）
-	if orderType == "buy" {
-		user, err := s.userRepo.FindByID(userID)
-		if err != nil {
-			return nil, err
-		}
-		if user.VirtualBalance < totalCost {
-			return nil, errors.New("insufficient balance")
-		}
+	rates, err := loadFeeRates(s.db, market.Category)
+	if err != nil {
+		return nil, err
 	}
 
-	// 验证持仓（卖出时）
-	if orderType == "sell" {
-		position, err := s.positionRepo.FindByUserAndOutcome(userID, marketID, outcomeID)
-		if err != nil {
-			return nil, err
-		}
-		if position == nil || position.Shares < shares {
-			return nil, errors.New("insufficient shares")
+	quote := &Quote{
+		MarketID:    marketID,
+		OutcomeID:   outcomeID,
+		Side:        side,
+		Shares:      shares,
+		PriceBefore: mm.price(outcomeID),
+	}
+
+	// 不设限价，尽可能成交全部份额
+	limit := 1.0
+	if side == "sell" {
+		limit = 0
+	}
+
+	onBook := func(candidate bookOrder, shares float64) (float64, float64, error) {
+		quote.TotalCost += shares * candidate.Price
+		return shares, 0, nil
+	}
+	onMarketMaker := func(shares, notional float64) error {
+		quote.TotalCost += notional
+		return nil
+	}
+
+	candidates, err := bookCandidates(s.db, outcomeID, side, limit)
+	if err != nil {
+		return nil, err
+	}
+	filled, err := routeOrder(mm, candidates, outcomeID, side, limit, shares, 0, onBook, onMarketMaker)
+	if err != nil {
+		return nil, err
+	}
+
+	quote.FilledShares = filled
+	quote.Fee = feeFor(quote.TotalCost, rates.TakerRate)
+	if filled > shareEpsilon {
+		quote.AvgPrice = quote.TotalCost / filled
+		quote.PriceImpact = (quote.AvgPrice - quote.PriceBefore) / quote.PriceBefore
+	}
+	quote.PriceAfter = mm.price(outcomeID)
+	quote.Prices = mm.prices()
+
+	return quote, nil
+}
+
+// PlaceOrder 下单
+func (s *TradingService) PlaceOrder(userID uint, params PlaceOrderParams) (*model.Order, error) {
+	order, err := s.placeOrder(userID, params)
+	if err == nil && order.FilledShares > 0 {
+		// 成交可能改变价格，异步检查条件单
+		go s.evaluateConditionalOrders(order.MarketID)
+	}
+	return order, err
+}
+
+// placeOrder 下单并撮合
+func (s *TradingService) placeOrder(userID uint, params PlaceOrderParams) (*model.Order, error) {
+	if err := params.normalize(); err != nil {
+		return nil, err
+	}
+
+	// 重复请求直接返回原订单
+	if params.IdempotencyKey != "" {
+		if order, err := s.replayIdempotentOrder(userID, params); order != nil || err != nil {
+			return order, err
 		}
 	}
 
+	// 验证市场状态
+	market, err := s.marketRepo.FindByID(params.MarketID)
+	if err != nil {
+		return nil, err
+	}
+	if err := marketTradingError(market.Status); err != nil {
+		return nil, err
+	}
+	if !hasOutcome(market, params.OutcomeID) {
+		return nil, errors.New("invalid outcome")
+	}
+
+	// 同一市场内的撮合串行执行
+	unlock := s.engine.lockMarket(market.ID)
+	defer unlock()
+
 	// 开始事务
 	tx := s.db.Begin()
 	defer func() {
@@ -80,89 +268,659 @@ func (s *TradingService) PlaceOrder(userID, marketID, outcomeID uint, orderType
 		}
 	}()
 
+	// 先锁定市场的结果选项：多实例下同一市场的撮合在此串行，订单簿与做市商状态均在锁内读取
+	mm, err := loadMarketMaker(tx, market)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	order, err := s.executeOrder(tx, userID, market, mm, params)
+	if errors.Is(err, errIdempotencyKeyClaimed) {
+		// 并发的重复请求已先行成交
+		tx.Rollback()
+		return s.replayIdempotentOrder(userID, params)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// executeOrder 在事务内创建并撮合订单。调用方需持有市场锁并已通过 loadMarketMaker 锁定结果选项，
+// 出错时由调用方回滚事务；同一事务内的多笔订单共用同一个做市商状态。
+func (s *TradingService) executeOrder(tx *gorm.DB, userID uint, market *model.Market, mm *marketMaker, params PlaceOrderParams) (*model.Order, error) {
+	marketID, outcomeID := params.MarketID, params.OutcomeID
+	orderType, shares, price := params.OrderType, params.Shares, params.Price
+
+	// 持锁后再次确认市场与结果选项状态，避免与市场关闭或熔断并发
+	if err := tx.Select("status").First(market, marketID).Error; err != nil {
+		return nil, err
+	}
+	if err := marketTradingError(market.Status); err != nil {
+		return nil, err
+	}
+	if mm.outcomes[mm.index[outcomeID]].Status == "halted" {
+		return nil, ErrOutcomeHalted
+	}
+	before := mm.prices()
+
+	// 费率在下单时确定，挂单后续成交沿用
+	rates, err := loadFeeRates(tx, market.Category)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := loadPositionLimits(tx, market)
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.checkOrderSize(shares); err != nil {
+		return nil, err
+	}
+
+	// 在事务内锁定并验证余额或持仓（买入按最大可能花费及手续费验证）。
+	// 市价买单不挂单，按当前订单簿与做市商路由的预估花费验证（受最差价格与预算约束），
+	// 实际扣款仍由 adjustBalance 的余额条件更新保证
+	maxSpend := shares * price
+	if params.OrderKind == OrderKindMarket && orderType == "buy" {
+		if maxSpend, err = routedCost(tx, mm, userID, outcomeID, price, shares, params.Budget); err != nil {
+			return nil, err
+		}
+	}
+	maxSpend *= 1 + math.Max(rates.MakerRate, rates.TakerRate)
+	if err := s.checkFunds(tx, userID, marketID, outcomeID, orderType, shares, maxSpend); err != nil {
+		return nil, err
+	}
+
 	// 创建订单
 	order := &model.Order{
-		UserID:     userID,
-		MarketID:   marketID,
-		OutcomeID:  outcomeID,
-		OrderType:  orderType,
-		Shares:     shares,
-		Price:      price,
-		TotalCost:  totalCost,
-		Status:     "filled", // 简化处理，直接成交
-		FilledAt:   &time.Time{},
-	}
-	*order.FilledAt = time.Now()
+		UserID:         userID,
+		MarketID:       marketID,
+		OutcomeID:      outcomeID,
+		OrderType:      orderType,
+		OrderKind:      params.OrderKind,
+		Shares:         shares,
+		Price:          price,
+		Budget:         params.Budget,
+		MakerFeeRate:   rates.MakerRate,
+		TakerFeeRate:   rates.TakerRate,
+		Status:         "pending",
+		TimeInForce:    params.TimeInForce,
+		ExpiresAt:      params.ExpiresAt,
+		IdempotencyKey: params.IdempotencyKey,
+
+		SelfTradePrevention: params.SelfTradePrevention,
+	}
 
 	if err := tx.Create(order).Error; err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
-	// 更新用户余额
+	if params.IdempotencyKey != "" {
+		claimed, err := s.claimIdempotencyKey(tx, userID, order.ID, params)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			return nil, errIdempotencyKeyClaimed
+		}
+	}
+
+	// 撮合
+	result, err := s.matchOrder(tx, mm, order)
+	if err != nil {
+		return nil, err
+	}
+
+	if shares == 0 {
+		// 仅按预算成交的市价单，以实际成交份额为订单份额
+		order.Shares = order.FilledShares
+		if order.FilledShares <= shareEpsilon && !result.selfTradeStopped {
+			return nil, errors.New("no liquidity available within the worst price")
+		}
+		if err := limits.checkOrderSize(order.Shares); err != nil {
+			return nil, err
+		}
+	}
+
+	remaining := order.Shares - order.FilledShares
+	resting := remaining > shareEpsilon
+	if resting && order.TimeInForce == TimeInForceFOK {
+		return nil, errors.New("fill-or-kill order cannot be fully filled")
+	}
+	if cancelSelfTradeRemainder(order, result) {
+		// 自成交保护撤销了剩余部分，不挂单
+		resting = false
+	} else if resting {
+		switch order.TimeInForce {
+		case TimeInForceIOC:
+			// 未成交部分直接撤销，不挂单
+			order.Status = "cancelled"
+			order.StatusReason = "ioc_unfilled"
+			resting = false
+		default:
+			// 未成交部分挂单，冻结资金或份额
+			if err := s.reserveOrder(tx, order, remaining); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 滑点保护：挂单的剩余部分按限价成交视为最差情况
+	worst := order.TotalCost
+	if resting {
+		worst += remaining * order.Price
+	}
+	if orderType == "buy" && params.MaxCost > 0 && worst > params.MaxCost+shareEpsilon {
+		return nil, errors.New("slippage exceeded: cost above max_cost")
+	}
+	if orderType == "sell" && params.MinProceeds > 0 && worst < params.MinProceeds-shareEpsilon {
+		return nil, errors.New("slippage exceeded: proceeds below min_proceeds")
+	}
+
+	if err := tx.Save(order).Error; err != nil {
+		return nil, err
+	}
+
+	// 买入后的持仓（含挂单）不得超过持仓限制
 	if orderType == "buy" {
-		if err := tx.Model(&model.User{}).
-			Where("id = ?", userID).
-			UpdateColumn("virtual_balance", gorm.Expr("virtual_balance - ?", totalCost)).
-			Error; err != nil {
-			tx.Rollback()
+		if err := limits.checkExposure(tx, userID, marketID, []uint{outcomeID}); err != nil {
 			return nil, err
 		}
+	}
+
+	if err := s.checkCircuitBreakers(tx, market, mm, before, outcomeID); err != nil {
+		return nil, err
+	}
+	// 价格已记录，同一事务内的后续订单只处理各自造成的变动
+	mm.dirty = false
+
+	if params.IdempotencyKey != "" {
+		if err := saveIdempotentResponse(tx, userID, params.IdempotencyKey, order); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// routedCost 预估买单按当前订单簿与做市商状态成交的花费（不含手续费），不改变做市商状态。
+// shares 为 0 表示仅按预算成交；不与用户自己的挂单成交。
+func routedCost(tx *gorm.DB, mm *marketMaker, userID, outcomeID uint, price, shares, budget float64) (float64, error) {
+	candidates, err := bookCandidates(tx, outcomeID, "buy", price)
+	if err != nil {
+		return 0, err
+	}
+	if shares == 0 {
+		shares = math.Inf(1)
+	}
+
+	var cost float64
+	onBook := func(candidate bookOrder, shares float64) (float64, float64, error) {
+		if candidate.UserID == userID {
+			return 0, 0, nil
+		}
+		cost += shares * candidate.Price
+		return shares, 0, nil
+	}
+	onMarketMaker := func(shares, notional float64) error {
+		cost += notional
+		return nil
+	}
+
+	if _, err := routeOrder(mm.clone(), candidates, outcomeID, "buy", price, shares, budget, onBook, onMarketMaker); err != nil {
+		return 0, err
+	}
+	return cost, nil
+}
+
+// matchResult 一次撮合中自成交保护的处理结果
+type matchResult struct {
+	selfTradePrevented bool // 新订单触发了自成交保护
+	selfTradeStopped   bool // 自成交保护停止了新订单的撮合
+}
+
+// routeOrder 在订单簿挂单与 LMSR 做市商之间按价格优先分配成交，PlaceOrder 与报价共用。
+// 订单簿成交价为挂单价格，做市商成交价由成本函数决定。
+// shares 可以为 +Inf（仅按预算成交）；budget 为买入时的最大花费，0 表示不限制。
+// onBook 在与挂单成交时调用，返回实际成交份额（0 表示跳过该挂单）和未成交但从订单中扣减的份额，
+// 返回 errStopMatching 时停止撮合并保留已成交部分；
+// onMarketMaker 在与做市商成交后调用，notional 为按分取整后的成交金额。
+func routeOrder(
+	mm *marketMaker,
+	candidates []bookOrder,
+	outcomeID uint,
+	side string,
+	limit, shares, budget float64,
+	onBook func(candidate bookOrder, shares float64) (float64, float64, error),
+	onMarketMaker func(shares, notional float64) error,
+) (float64, error) {
+	remaining := shares
+	filled, spent := 0.0, 0.0
+
+	// done 份额或预算已用尽
+	done := func() bool {
+		return remaining <= shareEpsilon || (budget > 0 && budget-spent <= shareEpsilon)
+	}
+
+	// fillFromMarketMaker 与做市商成交，直到做市商价格到达 bound 或全部成交
+	fillFromMarketMaker := func(bound float64) error {
+		if done() {
+			return nil
+		}
+
+		price := mm.price(outcomeID)
+		var amount float64
+		if side == "buy" {
+			if price >= bound {
+				return nil
+			}
+			amount = math.Min(remaining, mm.sharesToPrice(outcomeID, bound))
+			if budget > 0 {
+				amount = math.Min(amount, mm.sharesForCost(outcomeID, budget-spent))
+			}
+		} else {
+			if price <= bound {
+				return nil
+			}
+			amount = math.Min(remaining, -mm.sharesToPrice(outcomeID, bound))
+		}
+		if amount <= shareEpsilon {
+			return nil
+		}
+
+		// 成交金额在计入余额前按分取整：买入成本向上取整，卖出所得向下取整，
+		// 取整后为 0 的成交不进行，避免不足一分的成交免费获得份额
+		var notional float64
+		if side == "buy" {
+			notional = ceilCents(mm.tradeCost(outcomeID, amount))
+		} else {
+			notional = floorCents(-mm.tradeCost(outcomeID, -amount))
+		}
+		if notional <= 0 {
+			return nil
+		}
+		if side == "buy" {
+			mm.execute(outcomeID, amount)
+		} else {
+			mm.execute(outcomeID, -amount)
+		}
+		remaining -= amount
+		filled += amount
+		spent += notional
+		return onMarketMaker(amount, notional)
+	}
+
+	for _, candidate := range candidates {
+		// 做市商价格优于该挂单时，先与做市商成交至挂单价格
+		if err := fillFromMarketMaker(candidate.Price); err != nil {
+			return 0, err
+		}
+		if done() {
+			break
+		}
+
+		amount := math.Min(remaining, candidate.Remaining)
+		if budget > 0 {
+			amount = math.Min(amount, (budget-spent)/candidate.Price)
+		}
+		n, reduced, err := onBook(candidate, amount)
+		if errors.Is(err, errStopMatching) {
+			return filled, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		remaining -= n + reduced
+		filled += n
+		spent += n * candidate.Price
+	}
+
+	// 剩余部分与做市商成交至限价
+	if err := fillFromMarketMaker(limit); err != nil {
+		return 0, err
+	}
+
+	return filled, nil
+}
+
+// matchOrder 撮合新订单并完成资金与持仓交割
+func (s *TradingService) matchOrder(tx *gorm.DB, mm *marketMaker, order *model.Order) (*matchResult, error) {
+	result := &matchResult{}
+
+	onBook := func(candidate bookOrder, shares float64) (float64, float64, error) {
+		maker := candidate.Order
+
+		// 不与自己的挂单成交
+		if maker.UserID == order.UserID {
+			reduced, err := s.preventSelfTrade(tx, order, maker, shares, result)
+			return 0, reduced, err
+		}
+
+		buy, sell := order, maker
+		if order.OrderType == "sell" {
+			buy, sell = maker, order
+		}
+		if err := s.settleFill(tx, buy, sell, maker, shares, candidate.Price); err != nil {
+			return 0, 0, err
+		}
+		if err := tx.Save(maker).Error; err != nil {
+			return 0, 0, err
+		}
+		return shares, 0, nil
+	}
+
+	onMarketMaker := func(shares, notional float64) error {
+		return s.settleMarketMakerFill(tx, order, shares, notional)
+	}
+
+	remaining := order.Shares - order.FilledShares
+	if order.Shares == 0 {
+		// 仅指定预算的市价单
+		remaining = math.Inf(1)
+	}
+	candidates, err := lockBookCandidates(tx, order.OutcomeID, order.OrderType, order.Price)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := routeOrder(mm, candidates, order.OutcomeID, order.OrderType, order.Price, remaining, order.Budget, onBook, onMarketMaker); err != nil {
+		return nil, err
+	}
+
+	if err := mm.save(tx); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// settleMarketMakerFill 结算与做市商的一笔成交，notional 已按分取整（见 routeOrder）
+func (s *TradingService) settleMarketMakerFill(tx *gorm.DB, order *model.Order, shares, notional float64) error {
+	price := notional / shares
 
-		// 记录交易
-		user, _ := s.userRepo.FindByID(userID)
-		txRecord := &model.Transaction{
-			UserID:       userID,
+	if order.OrderType == "buy" {
+		balance, err := s.adjustBalance(tx, order.UserID, -notional)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&model.Transaction{
+			UserID:       order.UserID,
 			Type:         "trade_buy",
-			Amount:       -totalCost,
-			BalanceAfter: user.VirtualBalance - totalCost,
+			Amount:       -notional,
+			BalanceAfter: balance,
 			OrderID:      &order.ID,
-			MarketID:     &marketID,
+			MarketID:     &order.MarketID,
 			Description:  "Buy shares",
+		}).Error; err != nil {
+			return err
 		}
-		tx.Create(txRecord)
-
 	} else {
-		if err := tx.Model(&model.User{}).
-			Where("id = ?", userID).
-			UpdateColumn("virtual_balance", gorm.Expr("virtual_balance + ?", totalCost)).
-			Error; err != nil {
-			tx.Rollback()
-			return nil, err
+		balance, err := s.adjustBalance(tx, order.UserID, notional)
+		if err != nil {
+			return err
 		}
-
-		// 记录交易
-		user, _ := s.userRepo.FindByID(userID)
-		txRecord := &model.Transaction{
-			UserID:       userID,
+		if err := tx.Create(&model.Transaction{
+			UserID:       order.UserID,
 			Type:         "trade_sell",
-			Amount:       totalCost,
-			BalanceAfter: user.VirtualBalance + totalCost,
+			Amount:       notional,
+			BalanceAfter: balance,
 			OrderID:      &order.ID,
-			MarketID:     &marketID,
+			MarketID:     &order.MarketID,
 			Description:  "Sell shares",
+		}).Error; err != nil {
+			return err
 		}
-		tx.Create(txRecord)
 	}
 
-	// 更新持仓
-	if err := s.updatePosition(tx, userID, marketID, outcomeID, orderType, shares, price); err != nil {
-		tx.Rollback()
-		return nil, err
+	if err := s.updatePosition(tx, order.UserID, order.MarketID, order.OutcomeID, order.OrderType, shares, price); err != nil {
+		return err
 	}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		return nil, err
+	fee := feeFor(notional, order.TakerFeeRate)
+	if err := s.chargeFee(tx, order, fee); err != nil {
+		return err
 	}
 
-	return order, nil
+	recordFill(order, shares, notional)
+	if err := recordTrade(tx, order, nil, shares, price, fee, 0); err != nil {
+		return err
+	}
+	return addVolume(tx, order.MarketID, order.OutcomeID, notional)
+}
+
+// settleFill 结算一笔成交：资金与持仓交割、收取手续费、更新订单成交状态和成交量。
+// 挂单方（maker）的资金（含手续费）或份额已在挂单时冻结：买方先从冻结中释放本笔花费再扣款，卖方从冻结份额中交割。
+func (s *TradingService) settleFill(tx *gorm.DB, buy, sell, maker *model.Order, shares, price float64) error {
+	notional := shares * price
+
+	// feeOf 按订单在本笔成交中的角色计算手续费
+	feeOf := func(order *model.Order) float64 {
+		if order == maker {
+			return feeFor(notional, order.MakerFeeRate)
+		}
+		return feeFor(notional, order.TakerFeeRate)
+	}
+
+	// 买方付款
+	buyFee := feeOf(buy)
+	if maker == buy {
+		if err := s.releaseForFill(tx, buy, shares, roundCents(notional)+buyFee); err != nil {
+			return err
+		}
+	}
+	balance, err := s.adjustBalance(tx, buy.UserID, -notional)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(&model.Transaction{
+		UserID:       buy.UserID,
+		Type:         "trade_buy",
+		Amount:       -notional,
+		BalanceAfter: balance,
+		OrderID:      &buy.ID,
+		MarketID:     &buy.MarketID,
+		Description:  "Buy shares",
+	}).Error; err != nil {
+		return err
+	}
+	if err := s.updatePosition(tx, buy.UserID, buy.MarketID, buy.OutcomeID, "buy", shares, price); err != nil {
+		return err
+	}
+	if err := s.chargeFee(tx, buy, buyFee); err != nil {
+		return err
+	}
+
+	// 卖方收款
+	if maker == sell {
+		if err := tx.Model(&model.Position{}).
+			Where("user_id = ? AND market_id = ? AND outcome_id = ?", sell.UserID, sell.MarketID, sell.OutcomeID).
+			UpdateColumn("locked_shares", gorm.Expr("locked_shares - ?", shares)).Error; err != nil {
+			return err
+		}
+	}
+	balance, err = s.adjustBalance(tx, sell.UserID, notional)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(&model.Transaction{
+		UserID:       sell.UserID,
+		Type:         "trade_sell",
+		Amount:       notional,
+		BalanceAfter: balance,
+		OrderID:      &sell.ID,
+		MarketID:     &sell.MarketID,
+		Description:  "Sell shares",
+	}).Error; err != nil {
+		return err
+	}
+	if err := s.updatePosition(tx, sell.UserID, sell.MarketID, sell.OutcomeID, "sell", shares, price); err != nil {
+		return err
+	}
+	sellFee := feeOf(sell)
+	if err := s.chargeFee(tx, sell, sellFee); err != nil {
+		return err
+	}
+
+	recordFill(buy, shares, notional)
+	recordFill(sell, shares, notional)
+
+	taker, takerFee, makerFee := buy, buyFee, sellFee
+	if maker == buy {
+		taker, takerFee, makerFee = sell, sellFee, buyFee
+	}
+	if err := recordTrade(tx, taker, maker, shares, price, takerFee, makerFee); err != nil {
+		return err
+	}
+	return addVolume(tx, buy.MarketID, buy.OutcomeID, notional)
+}
+
+// recordFill 更新订单的成交份额、成交金额与状态
+func recordFill(order *model.Order, shares, notional float64) {
+	order.FilledShares += shares
+	order.TotalCost += notional
+	order.AvgFillPrice = order.TotalCost / order.FilledShares
+	if order.Shares-order.FilledShares <= shareEpsilon {
+		now := time.Now()
+		order.Status = "filled"
+		order.FilledAt = &now
+	} else {
+		order.Status = "partially_filled"
+	}
+}
+
+// recordTrade 写入成交记录并更新市场统计，maker 为空表示与做市商成交
+func recordTrade(tx *gorm.DB, taker, maker *model.Order, shares, price, takerFee, makerFee float64) error {
+	trade := &model.Trade{
+		MarketID:     taker.MarketID,
+		OutcomeID:    taker.OutcomeID,
+		TakerOrderID: taker.ID,
+		TakerUserID:  taker.UserID,
+		TakerSide:    taker.OrderType,
+		Price:        price,
+		Shares:       shares,
+		Notional:     shares * price,
+		TakerFee:     takerFee,
+		MakerFee:     makerFee,
+	}
+	if maker != nil {
+		trade.MakerOrderID = &maker.ID
+		trade.MakerUserID = &maker.UserID
+	}
+	if err := tx.Create(trade).Error; err != nil {
+		return err
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "market_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"total_trades":     gorm.Expr("market_statistics.total_trades + 1"),
+			"total_volume":     gorm.Expr("market_statistics.total_volume + ?", trade.Notional),
+			"last_trade_price": price,
+			"updated_at":       time.Now(),
+		}),
+	}).Create(&model.MarketStatistics{
+		MarketID:       taker.MarketID,
+		TotalTrades:    1,
+		TotalVolume:    trade.Notional,
+		LastTradePrice: price,
+	}).Error
+}
+
+// addVolume 累加结果选项与市场的成交量
+func addVolume(tx *gorm.DB, marketID, outcomeID uint, notional float64) error {
+	if err := tx.Model(&model.Outcome{}).
+		Where("id = ?", outcomeID).
+		UpdateColumn("total_volume", gorm.Expr("total_volume + ?", notional)).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&model.Market{}).
+		Where("id = ?", marketID).
+		UpdateColumn("total_volume", gorm.Expr("total_volume + ?", notional)).Error
+}
+
+// checkFunds 以 SELECT ... FOR UPDATE 锁定用户或持仓行并验证可用余额（买入花费 cost）或可卖份额
+func (s *TradingService) checkFunds(tx *gorm.DB, userID, marketID, outcomeID uint, orderType string, shares, cost float64) error {
+	if orderType == "buy" {
+		var user model.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("user not found")
+			}
+			return err
+		}
+		if user.VirtualBalance < cost {
+			return errors.New("insufficient balance")
+		}
+		return nil
+	}
+
+	var position model.Position
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND market_id = ? AND outcome_id = ?", userID, marketID, outcomeID).
+		First(&position).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("insufficient shares")
+	}
+	if err != nil {
+		return err
+	}
+	if position.Shares-position.LockedShares < shares {
+		return errors.New("insufficient shares")
+	}
+	return nil
+}
+
+// lockMarketRows 在事务内锁定市场的结果选项行，用于与下单保持一致的加锁顺序
+func lockMarketRows(tx *gorm.DB, marketID uint) error {
+	var outcomes []model.Outcome
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("market_id = ?", marketID).
+		Order("id ASC").
+		Find(&outcomes).Error
+}
+
+// adjustBalance 在事务内调整用户余额并返回调整后的余额，扣款时余额不足则失败
+func (s *TradingService) adjustBalance(tx *gorm.DB, userID uint, amount float64) (float64, error) {
+	query := tx.Model(&model.User{}).Where("id = ?", userID)
+	if amount < 0 {
+		query = query.Where("virtual_balance >= ?", -amount)
+	}
+
+	result := query.UpdateColumn("virtual_balance", gorm.Expr("virtual_balance + ?", amount))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, errors.New("insufficient balance")
+	}
+
+	return s.currentBalance(tx, userID)
+}
+
+// hasOutcome 判断结果选项是否属于该市场
+func hasOutcome(market *model.Market, outcomeID uint) bool {
+	for _, outcome := range market.Outcomes {
+		if outcome.ID == outcomeID {
+			return true
+		}
+	}
+	return false
 }
 
 // updatePosition 更新持仓
 func (s *TradingService) updatePosition(tx *gorm.DB, userID, marketID, outcomeID uint, orderType string, shares, price float64) error {
 	var position model.Position
-	err := tx.Where("user_id = ? AND market_id = ? AND outcome_id = ?", userID, marketID, outcomeID).
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND market_id = ? AND outcome_id = ?", userID, marketID, outcomeID).
 		First(&position).Error
 
 	if err == gorm.ErrRecordNotFound {
@@ -191,9 +949,17 @@ func (s *TradingService) updatePosition(tx *gorm.DB, userID, marketID, outcomeID
 		position.AvgPrice = totalCost / position.Shares
 	} else {
 		position.Shares -= shares
-		if position.Shares < 0 {
+		if position.Shares < position.LockedShares-shareEpsilon {
 			return errors.New("insufficient shares")
 		}
+
+		// 持仓清空后撤销该持仓上的卖出条件单
+		if position.Shares <= shareEpsilon {
+			if err := cancelConditionalOrders(tx, "position_closed",
+				"user_id = ? AND outcome_id = ? AND order_type = ?", userID, outcomeID, "sell"); err != nil {
+				return err
+			}
+		}
 	}
 
 	return tx.Save(&position).Error
@@ -204,12 +970,77 @@ func (s *TradingService) GetUserOrders(userID uint, page, pageSize int) ([]model
 	return s.orderRepo.FindByUserID(userID, page, pageSize)
 }
 
+// GetMarketTrades 按游标分页获取市场成交记录，返回下一页游标（0 表示没有更多）
+func (s *TradingService) GetMarketTrades(marketID, cursor uint, limit int) ([]model.Trade, uint, error) {
+	if _, err := s.marketRepo.FindByID(marketID); err != nil {
+		return nil, 0, err
+	}
+
+	trades, err := s.tradeRepo.FindByMarketID(marketID, cursor, limit+1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var next uint
+	if len(trades) > limit {
+		trades = trades[:limit]
+		next = trades[limit-1].ID
+	}
+	return trades, next, nil
+}
+
+// GetOrderFills 获取用户订单的成交明细
+func (s *TradingService) GetOrderFills(orderID, userID uint) (*model.Order, []model.Trade, error) {
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.UserID != userID {
+		return nil, nil, errors.New("order not found")
+	}
+
+	trades, err := s.tradeRepo.FindByOrderID(orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, trades, nil
+}
+
 // GetUserPositions 获取用户持仓
 func (s *TradingService) GetUserPositions(userID uint) ([]model.Position, error) {
 	return s.positionRepo.FindByUserID(userID)
 }
 
-// CancelOrder 取消订单
+// CancelOrder 取消订单，释放未成交部分冻结的资金或份额
 func (s *TradingService) CancelOrder(orderID, userID uint) error {
-	return s.orderRepo.Cancel(orderID, userID)
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil {
+		return err
+	}
+	if order.UserID != userID {
+		return errors.New("order not found")
+	}
+
+	unlock := s.engine.lockMarket(order.MarketID)
+	defer unlock()
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockMarketRows(tx, order.MarketID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := s.cancelOrderTx(tx, orderID, "user_cancelled"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
 }